@@ -0,0 +1,63 @@
+package sago
+
+import (
+	"reflect"
+	"testing"
+)
+
+type benchUser struct {
+	ID    int64  `db:"id"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+}
+
+func newBenchExecutor(b *testing.B, sqlText string, args ...string) *SQLExecutor {
+	m := New()
+	fn := &Fn{Name: "Bench", SQL: sqlText, Args: args}
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	e := NewSQLExecutor("user", "benchDao", []reflect.Type{reflect.TypeOf([]benchUser{}), emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	e.Vars = m.mergeVars(&SQLSet{})
+	return e
+}
+
+func benchmarkRender(b *testing.B, e *SQLExecutor, args ...interface{}) {
+	values := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		values[i] = reflect.ValueOf(arg)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := e.executeTpl(values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderSelect(b *testing.B) {
+	e := newBenchExecutor(b, "select {{.fields}} from {{.table}} where `name` = {{arg .name}} and `id` {{in .ids}}", "name", "ids")
+	benchmarkRender(b, e, "foo", []int64{1, 2, 3})
+}
+
+func BenchmarkRenderInsert(b *testing.B) {
+	e := newBenchExecutor(b, "insert into {{.table}} (`name`, `email`) values ({{arg .u.Name}}, {{arg .u.Email}})", "u")
+	benchmarkRender(b, e, &benchUser{Name: "foo", Email: "foo@example.com"})
+}
+
+func BenchmarkRenderExecute(b *testing.B) {
+	e := newBenchExecutor(b, "update {{.table}} set `name` = {{arg .name}} where `id` = {{arg .id}}", "name", "id")
+	benchmarkRender(b, e, "foo", int64(1))
+}
+
+// sync.Pool 未命中(包括每次 GC 之后)时创建渲染对象的开销
+func BenchmarkNewRenderer(b *testing.B) {
+	e := newBenchExecutor(b, "select {{.fields}} from {{.table}} where `name` = {{arg .name}} and `id` {{in .ids}}", "name", "ids")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.newRenderer()
+	}
+}
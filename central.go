@@ -1,6 +1,7 @@
 package sago
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"reflect"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/mengxiaozhu/linkerror"
 )
@@ -21,6 +23,9 @@ func New() *Central {
 	m := &Central{
 		files:         []*File{},
 		funcFactories: []TemplateFuncFactory{},
+		vars:          map[string]interface{}{},
+		Balancer:      RoundRobin(),
+		Classifiers:   defaultClassifiers(),
 	}
 	m.AddFunc(MethodNameArg, argFunc)
 	m.AddFunc(MethodInArg, inFunc)
@@ -34,17 +39,32 @@ type TemplateFuncFactory struct {
 	Create func(ctx *FnCtx) TemplateFunc
 }
 type Central struct {
-	Cache         Cache
+	Cache Cache
+	// 选择从库,默认轮询
+	Balancer Balancer
+	// 语句未声明 retry 时的重试策略,默认不重试
+	Retry RetryPolicy
+	// 语句未声明 timeout 时的超时,默认不限制
+	Timeout time.Duration
+	// 按方言判断错误是否可以重试
+	Classifiers map[Dialect]ErrorClassifier
+	// 每个 DB 缓存的预编译语句数,在 Map 之前设置,为 0 时不预编译
+	PrepareCache  int
+	stmts         *stmtRegistry
+	statements    []*mappedStatement
+	statementKeys map[statementKey]int
+	migrations    []Migration
 	files         []*File
 	funcFactories []TemplateFuncFactory
 	converted     bool
 	fullNameMap   map[string]*SQLSet
+	vars          map[string]interface{}
 }
 
 const xmlSuffix = ".sql.xml"
 const yamlSuffix = ".sql.yaml"
 
-// 扫描文件下以所有以 .sql.xml 结尾的文件
+// 扫描文件下以所有以 .sql.xml 结尾的文件,以及 NNN_name.up.sql 迁移文件
 // <sago>
 // 	<package></package>
 //	<type></type>
@@ -54,6 +74,8 @@ const yamlSuffix = ".sql.yaml"
 // 	</select>
 //	<execute></execute>
 //	<insert></insert>
+//	<update></update>
+//	<delete></delete>
 // </sago>
 func (m *Central) ScanDir(dirPath string) (e error) {
 	dir, err := os.Open(dirPath)
@@ -88,6 +110,14 @@ func (m *Central) ScanDir(dirPath string) (e error) {
 					return linkerror.New(YAML, err.Error())
 				}
 				m.files = append(m.files, root)
+			default:
+				migration, err := parseMigrationFile(filepath.Join(dirPath, name), name)
+				if err != nil {
+					return linkerror.New(Dir, err.Error())
+				}
+				if migration != nil {
+					m.migrations = append(m.migrations, *migration)
+				}
 			}
 		}
 	}
@@ -103,6 +133,9 @@ func (m *Central) Map(daoObjects ...interface{}) error {
 			return err
 		}
 	}
+	if m.PrepareCache > 0 && m.stmts == nil {
+		m.stmts = newStmtRegistry(m.PrepareCache)
+	}
 	for _, dao := range daoObjects {
 		err := m.mapMethods(dao)
 		if err != nil {
@@ -133,39 +166,151 @@ func (m *Central) convert() (err *linkerror.Error) {
 			Package: xml.Package,
 			Type:    xml.Type,
 			Table:   xml.Table,
+			Vars:    map[string]string{},
+		}
+		for _, v := range xml.Vars {
+			sqls.Vars[v.Name] = strings.TrimSpace(v.Value)
 		}
 		sqls.Functions = map[string]*Fn{}
-		insertByType("select", sqls.Functions, xml.Selects)
-		insertByType("execute", sqls.Functions, xml.Executes)
-		insertByType("insert", sqls.Functions, xml.Inserts)
+		for _, typed := range []struct {
+			typ  string
+			sqls []SQLContent
+		}{
+			{"select", xml.Selects},
+			{"execute", xml.Executes},
+			{"insert", xml.Inserts},
+			{"update", xml.Updates},
+			{"delete", xml.Deletes},
+		} {
+			err = insertByType(typed.typ, sqls.Functions, typed.sqls)
+			if err != nil {
+				return
+			}
+		}
+		err = linkResultMaps(name, sqls.Functions, xml)
+		if err != nil {
+			return
+		}
 		fullNameSQLs[name] = sqls
 	}
+	fragments, err := collectFragments(files)
+	if err != nil {
+		return
+	}
+	for name, sqls := range fullNameSQLs {
+		for _, fn := range sqls.Functions {
+			expanded, includeErr := expandIncludes(fragments, name, fn.SQL, 0)
+			if includeErr != nil {
+				return linkerror.New(BadSQLTemplate, name+"."+fn.Name+": "+includeErr.Error())
+			}
+			fn.SQL = expanded
+		}
+	}
 	m.fullNameMap = fullNameSQLs
 	m.converted = true
 	return nil
 }
 
-func insertByType(typ string, m map[string]*Fn, sqls []SQLContent) {
+func insertByType(typ string, m map[string]*Fn, sqls []SQLContent) *linkerror.Error {
 	for _, v := range sqls {
+		sqlText := v.SQL
+		if strings.Contains(v.Inner, "<") {
+			compiled, err := compileDynamic(v.Inner)
+			if err != nil {
+				return linkerror.New(BadSQLTemplate, v.Name+": "+err.Error())
+			}
+			sqlText = compiled
+		}
+		if v.Key != "" && typ != "select" {
+			return linkerror.New(XMLMappedWrong, v.Name+": key is only supported on select, not "+typ)
+		}
+		args, argTypes := strToArgs(v.Args)
+		backoff, err := parseDuration(v.Backoff)
+		if err != nil {
+			return linkerror.New(XMLMappedWrong, v.Name+": bad backoff "+v.Backoff)
+		}
+		timeout, err := parseDuration(v.Timeout)
+		if err != nil {
+			return linkerror.New(XMLMappedWrong, v.Name+": bad timeout "+v.Timeout)
+		}
 		m[v.Name] = &Fn{
-			Name: v.Name,
-			SQL:  strings.TrimSpace(v.SQL),
-			Type: typ,
-			Args: strToArgs(v.Args),
+			Name:       v.Name,
+			SQL:        strings.TrimSpace(sqlText),
+			Type:       typ,
+			Args:       args,
+			ArgTypes:   argTypes,
+			MustAffect: v.MustAffect,
+			Key:        v.Key,
+			ShardKey:   v.ShardKey,
+			Retry:      v.Retry,
+			Backoff:    backoff,
+			Idempotent: v.Idempotent,
+			Timeout:    timeout,
 		}
 	}
+	return nil
 }
 
-func strToArgs(str string) []string {
-	splits := strings.Split(str, ",")
-	var result []string
-	for _, v := range splits {
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func linkResultMaps(name string, fns map[string]*Fn, f *File) *linkerror.Error {
+	resultMaps := map[string]*ResultMapContent{}
+	for i := range f.ResultMaps {
+		resultMaps[f.ResultMaps[i].ID] = &f.ResultMaps[i]
+	}
+	for _, v := range f.Selects {
+		if v.ResultMap == "" {
+			continue
+		}
+		resultMap := resultMaps[v.ResultMap]
+		if resultMap == nil {
+			return linkerror.New(XMLMappedWrong, name+"."+v.Name+" uses undefined resultMap "+v.ResultMap)
+		}
+		fns[v.Name].ResultMap = resultMap
+	}
+	return nil
+}
+
+// args="name:string, ids:[]int64, u:*User",类型可省略
+func strToArgs(str string) (names []string, types []string) {
+	for _, v := range splitArgs(str) {
 		v = strings.TrimSpace(v)
-		if v != "" {
-			result = append(result, v)
+		if v == "" {
+			continue
+		}
+		typ := ""
+		if i := strings.Index(v, ":"); i >= 0 {
+			v, typ = strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:])
 		}
+		names = append(names, v)
+		types = append(types, typ)
 	}
-	return result
+	return
+}
+
+// 按逗号切分,忽略括号内的逗号
+func splitArgs(str string) []string {
+	var result []string
+	depth, start := 0, 0
+	for i, c := range str {
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, str[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, str[start:])
 }
 
 func (m *Central) getSQLSet(typ reflect.Type) (sqlSet *SQLSet, name string) {
@@ -182,10 +327,37 @@ func (m *Central) getSQLSet(typ reflect.Type) (sqlSet *SQLSet, name string) {
 	return nil, ""
 }
 
+// 添加模板函数,fnFactory 对每个复用的渲染对象只调用一次
+// 函数只应通过 ctx.Args 记录参数,ctx 在每次渲染前重置
 func (m *Central) AddFunc(name string, fnFactory func(ctx *FnCtx) (fn TemplateFunc)) {
 	m.funcFactories = append(m.funcFactories, TemplateFuncFactory{Create: fnFactory, Name: name})
 }
 
+// 设置全局模板变量,语句中以 {{.vars.name}} 使用,需在 Map 之前调用
+// 同名时文件中的 <var> 优先
+func (m *Central) SetVar(name string, value interface{}) {
+	m.vars[name] = value
+}
+
+// 关闭 PrepareCache 预编译的所有语句,不会关闭 DB,之后不应再调用生成的函数
+func (m *Central) Close() error {
+	if m.stmts != nil {
+		m.stmts.close()
+	}
+	return nil
+}
+
+func (m *Central) mergeVars(sqlSet *SQLSet) map[string]interface{} {
+	vars := make(map[string]interface{}, len(m.vars)+len(sqlSet.Vars))
+	for k, v := range m.vars {
+		vars[k] = v
+	}
+	for k, v := range sqlSet.Vars {
+		vars[k] = v
+	}
+	return vars
+}
+
 func (m *Central) emptyFuncMap() template.FuncMap {
 	fm := template.FuncMap{}
 	for _, factory := range m.funcFactories {
@@ -194,18 +366,141 @@ func (m *Central) emptyFuncMap() template.FuncMap {
 	return fm
 }
 
-func getDBFieldFromStruct(st reflect.Value) (DB *sql.DB, err *linkerror.Error) {
-	dbValue := st.FieldByName("DB")
-	if dbValue == emptyReflectValue {
-		return nil, linkerror.New(NoDBField, st.String()+" must have a field named DB with *sql.DB type")
+func (m *Central) parseTemplate(fn *Fn) (*template.Template, error) {
+	return template.New(fn.Name).Funcs(m.emptyFuncMap()).Funcs(builtinFuncs).Funcs(modelFuncPlaceholders).Parse(fn.SQL)
+}
+
+// 不作为嵌套 DAO 处理的字段
+var reservedFields = map[string]bool{"DB": true, "ReadDB": true, "ReadDBs": true, "Sharding": true, "Cache": true}
+
+var (
+	sqlDBType  = reflect.TypeOf(&sql.DB{})
+	sqlDBsType = reflect.TypeOf([]*sql.DB{})
+)
+
+// DAO 使用的主库、从库与分片
+type daoDBs struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	sharding *Sharding
+}
+
+// 按名称取字段,途经的 nil 匿名指针会被分配
+func fieldByName(st reflect.Value, name string) reflect.Value {
+	f, ok := st.Type().FieldByName(name)
+	if !ok {
+		return emptyReflectValue
+	}
+	v := st
+	for i, x := range f.Index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return emptyReflectValue
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// 取得结构体的 DB,DB 为 nil 时设置为上级的 DB,没有 DB 字段时直接使用上级的 DB
+// 从库取 ReadDB 与 ReadDBs,都没有时使用上级的从库
+func resolveDBs(st reflect.Value, parent daoDBs) (dbs daoDBs, hasField bool, err *linkerror.Error) {
+	dbs = parent
+	dbValue := fieldByName(st, "DB")
+	if dbValue != emptyReflectValue {
+		if dbValue.Type() != sqlDBType {
+			return dbs, true, linkerror.New(NoDBField, st.Type().String()+" must have a field named DB with *sql.DB type")
+		}
+		if dbValue.IsNil() && parent.primary != nil && dbValue.CanSet() {
+			dbValue.Set(reflect.ValueOf(parent.primary))
+		}
+		dbs.primary = dbValue.Interface().(*sql.DB)
+		hasField = true
+	}
+	var replicas []*sql.DB
+	if readDB := fieldByName(st, "ReadDB"); readDB != emptyReflectValue {
+		if readDB.Type() != sqlDBType {
+			return dbs, hasField, linkerror.New(NoDBField, st.Type().String()+" field ReadDB must be *sql.DB")
+		}
+		if !readDB.IsNil() {
+			replicas = append(replicas, readDB.Interface().(*sql.DB))
+		}
+	}
+	if readDBs := fieldByName(st, "ReadDBs"); readDBs != emptyReflectValue {
+		if readDBs.Type() != sqlDBsType {
+			return dbs, hasField, linkerror.New(NoDBField, st.Type().String()+" field ReadDBs must be []*sql.DB")
+		}
+		for _, db := range readDBs.Interface().([]*sql.DB) {
+			if db != nil {
+				replicas = append(replicas, db)
+			}
+		}
+	}
+	if len(replicas) > 0 {
+		dbs.replicas = replicas
+	}
+	if sharding := fieldByName(st, "Sharding"); sharding != emptyReflectValue {
+		if sharding.Type() != shardingType {
+			return dbs, hasField, linkerror.New(NoDBField, st.Type().String()+" field Sharding must be *sago.Sharding")
+		}
+		if !sharding.IsNil() {
+			dbs.sharding = sharding.Interface().(*Sharding)
+			if checkErr := dbs.sharding.check(); checkErr != nil {
+				return dbs, hasField, linkerror.New(NoDBField, st.Type().String()+": "+checkErr.Error())
+			}
+		}
+	}
+	return dbs, hasField, nil
+}
+
+// 是否包含函数字段,包括匿名嵌入结构体中的
+func hasFuncFields(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Type.Kind() == reflect.Func {
+			return true
+		}
+		if embedded := f.Type; f.Anonymous {
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && hasFuncFields(embedded) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 嵌套字段是否为需要映射的 DAO:有对应的 SQL,或嵌套地包含这样的类型
+// 只有函数字段的类型(如 *http.Client)不是 DAO
+func (m *Central) isDaoType(typ reflect.Type, visiting map[reflect.Type]bool) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || visiting[typ] {
+		return false
+	}
+	if sqlSet, _ := m.getSQLSet(typ); sqlSet != nil {
+		return true
 	}
-	if dbValue.Type() != reflect.TypeOf(&sql.DB{}) {
-		return nil, linkerror.New(NoDBField, st.String()+" must have a field named DB with *sql.DB type")
+	visiting[typ] = true
+	defer delete(visiting, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath == "" && !reservedFields[f.Name] && m.isDaoType(f.Type, visiting) {
+			return true
+		}
 	}
-	return dbValue.Interface().(*sql.DB), nil
+	return false
 }
 
-func (m *Central) mapCachedMethods(structValue reflect.Value) (err *linkerror.Error) {
+func (m *Central) mapCachedMethods(structValue reflect.Value, dbs daoDBs) (err *linkerror.Error) {
 	cacheField := structValue.FieldByName("Cache")
 	if cacheField == emptyReflectValue {
 		return
@@ -222,71 +517,155 @@ func (m *Central) mapCachedMethods(structValue reflect.Value) (err *linkerror.Er
 	}
 	cachedObject := reflect.New(structValue.Type())
 	cacheField.Set(cachedObject)
-	cachedObject.Elem().FieldByName("DB").Set(structValue.FieldByName("DB"))
-	err = m.injectFuncs(true, cachedObject.Elem().Type(), cachedObject.Elem())
+	if _, _, err = resolveDBs(cachedObject.Elem(), dbs); err != nil {
+		return
+	}
+	err = m.injectFuncs(true, cachedObject.Elem(), dbs, nil)
 	if err != nil {
 		return
 	}
 	return
 }
 
-func (m *Central) injectFuncs(needCache bool, typ reflect.Type, value reflect.Value) (err *linkerror.Error) {
-	sqlSet, name := m.getSQLSet(typ)
-	if sqlSet == nil {
-		return linkerror.New(XMLMappedWrong, "cannot found sqls to this type "+typ.PkgPath()+"."+typ.Name())
-	}
+type namedSQLSet struct {
+	sqlSet *SQLSet
+	name   string
+}
 
-	// get value's db field
-	db, err := getDBFieldFromStruct(value)
-	if err != nil {
-		return err
+// 注入函数字段
+// 匿名嵌入结构体的函数先在外层 DAO 的 SQL 中查找,再到嵌入结构体自身的 SQL 中查找
+// table 等始终取最外层的 SQL,使 BaseDao 中的通用函数作用于外层 DAO 的表
+func (m *Central) injectFuncs(needCache bool, value reflect.Value, dbs daoDBs, sqlSets []namedSQLSet) (err *linkerror.Error) {
+	typ := value.Type()
+	if sqlSet, name := m.getSQLSet(typ); sqlSet != nil {
+		sqlSets = append(sqlSets[:len(sqlSets):len(sqlSets)], namedSQLSet{sqlSet, name})
 	}
 	// fill all func
 	num := typ.NumField()
 
 	for i := 0; i < num; i++ {
 		f := typ.Field(i)
-		if f.Type.Kind() == reflect.Func {
-			fn, err := m.generateFunc(needCache, name, sqlSet.Functions[f.Name], f, db, sqlSet.Table)
+		field := value.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Func:
+			if !field.CanSet() {
+				continue
+			}
+			if len(sqlSets) == 0 {
+				return linkerror.New(XMLMappedWrong, "cannot found sqls to this type "+typ.PkgPath()+"."+typ.Name())
+			}
+			owner := sqlSets[0]
+			fn := owner.sqlSet.Functions[f.Name]
+			for _, embedded := range sqlSets[1:] {
+				if fn != nil {
+					break
+				}
+				fn = embedded.sqlSet.Functions[f.Name]
+			}
+			generated, err := m.generateFunc(needCache, owner.name, fn, f, dbs, owner.sqlSet)
 			if err != nil {
 				return err
 			}
-			value.Field(i).Set(fn)
+			field.Set(generated)
+		case f.Anonymous:
+			if f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct {
+				if field.IsNil() {
+					if !field.CanSet() {
+						continue
+					}
+					field.Set(reflect.New(f.Type.Elem()))
+				}
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Struct {
+				err = m.injectFuncs(needCache, field, dbs, sqlSets)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return
 }
 
-func (m *Central) mapMethods(obj interface{}) (err *linkerror.Error) {
-	value := reflect.ValueOf(obj)
+// 映射一个 DAO 结构体,以及其中嵌套的 DAO 字段
+// 嵌套的 DAO 解析各自的 SQL,没有 DB 时使用上级的 DB
+func (m *Central) mapStruct(value reflect.Value, parent daoDBs, path map[reflect.Type]bool) (err *linkerror.Error) {
 	typ := value.Type()
-	// 检查基本类型是否为Ptr
-	if typ.Kind() != reflect.Ptr {
-		return linkerror.New(WrongTypeToMap, "but got "+typ.Kind().String()+" -> "+typ.String())
-	}
-	// 取得具体对象
-	value = value.Elem()
-	typ = typ.Elem()
-	err = m.injectFuncs(false, typ, value)
+	path[typ] = true
+	defer delete(path, typ)
+
+	dbs, hasDBField, err := resolveDBs(value, parent)
 	if err != nil {
 		return err
 	}
-	err = m.mapCachedMethods(value)
+	if hasFuncFields(typ) {
+		if !hasDBField && dbs.primary == nil && dbs.sharding == nil {
+			return linkerror.New(NoDBField, typ.String()+" must have a field named DB with *sql.DB type")
+		}
+		err = m.injectFuncs(false, value, dbs, nil)
+		if err != nil {
+			return err
+		}
+	}
+	err = m.mapCachedMethods(value, dbs)
 	if err != nil {
 		return err
 	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" || f.Anonymous || reservedFields[f.Name] || !m.isDaoType(f.Type, map[reflect.Type]bool{}) {
+			continue
+		}
+		field := value.Field(i)
+		if f.Type.Kind() == reflect.Ptr {
+			if path[f.Type.Elem()] {
+				continue
+			}
+			if field.IsNil() {
+				field.Set(reflect.New(f.Type.Elem()))
+			}
+			field = field.Elem()
+		}
+		err = m.mapStruct(field, dbs, path)
+		if err != nil {
+			return err
+		}
+	}
 	return
 }
 
+func (m *Central) mapMethods(obj interface{}) (err *linkerror.Error) {
+	value := reflect.ValueOf(obj)
+	typ := value.Type()
+	// 检查基本类型是否为Ptr
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return linkerror.New(WrongTypeToMap, "but got "+typ.Kind().String()+" -> "+typ.String())
+	}
+	// 取得具体对象
+	return m.mapStruct(value.Elem(), daoDBs{}, map[reflect.Type]bool{})
+}
+
 // generate func
-func (m *Central) generateFunc(needCache bool, usedName string, fn *Fn, f reflect.StructField, db *sql.DB, table string) (generatedFunc reflect.Value, err *linkerror.Error) {
+// 第一个参数为 context.Context 时不计入 args
+func (m *Central) generateFunc(needCache bool, usedName string, fn *Fn, f reflect.StructField, dbs daoDBs, sqlSet *SQLSet) (generatedFunc reflect.Value, err *linkerror.Error) {
 	if fn == nil {
 		return emptyReflectValue, linkerror.New(XMLMappedWrong, "cannot found func "+f.Name+" mapped sql")
 	}
-	if len(fn.Args) != f.Type.NumIn() {
-		return emptyReflectValue, linkerror.New(XMLMappedWrong, fmt.Sprint(f.Name, " Args number is wrong , expected ", f.Type.NumIn(), " but xml defined ", fn.Args, "length:", len(fn.Args)))
+	hasCtx := f.Type.NumIn() > 0 && f.Type.In(0) == contextType
+	offset := 0
+	if hasCtx {
+		offset = 1
+	}
+	if len(fn.Args) != f.Type.NumIn()-offset {
+		return emptyReflectValue, linkerror.New(XMLMappedWrong, fmt.Sprint(f.Name, " Args number is wrong , expected ", f.Type.NumIn()-offset, " but xml defined ", fn.Args, "length:", len(fn.Args)))
 	}
-	tpl, tplErr := template.New(fn.Name).Funcs(m.emptyFuncMap()).Parse(fn.SQL)
+	for i, declared := range fn.ArgTypes {
+		if declared != "" && !matchArgType(declared, f.Type, i+offset) {
+			return emptyReflectValue, linkerror.New(XMLMappedWrong, fmt.Sprint(usedName, ".", f.Name, " arg ", fn.Args[i], " declared as ", declared, " but func takes ", f.Type.In(i+offset)))
+		}
+	}
+	tpl, tplErr := m.parseTemplate(fn)
 	if tplErr != nil {
 		return emptyReflectValue, linkerror.New(BadSQLTemplate, tplErr.Error()+":"+fn.SQL)
 	}
@@ -295,7 +674,69 @@ func (m *Central) generateFunc(needCache bool, usedName string, fn *Fn, f reflec
 	for n := 0; n < out; n++ {
 		returnTypes = append(returnTypes, f.Type.Out(n))
 	}
-	sqlExecutor := NewSQLExecutor(table, usedName, returnTypes, fn, tpl, db, m.funcFactories)
+	var execReturn execReturn
+	var checkErr error
+	if fn.Type == "select" {
+		checkErr = checkSelectReturns(returnTypes, fn)
+	} else {
+		execReturn, checkErr = checkExecReturns(returnTypes)
+	}
+	if checkErr != nil {
+		return emptyReflectValue, linkerror.New(XMLMappedWrong, usedName+"."+f.Name+": "+checkErr.Error())
+	}
+	sqlExecutor := NewSQLExecutor(sqlSet.Table, usedName, returnTypes, fn, tpl, dbs.primary, m.funcFactories)
+	sqlExecutor.execReturn = execReturn
+	sqlExecutor.variadic = f.Type.IsVariadic()
+	sqlExecutor.hasCtx = hasCtx
+	sqlExecutor.setReplicas(dbs.replicas, m.Balancer)
+	sqlExecutor.Vars = m.mergeVars(sqlSet)
+	if fn.Retry > 0 && fn.Type != "select" && !fn.Idempotent {
+		return emptyReflectValue, linkerror.New(XMLMappedWrong, usedName+"."+f.Name+": retry on "+fn.Type+" requires idempotent=\"true\"")
+	}
+	sqlExecutor.retry = m.Retry
+	if fn.Retry > 0 {
+		sqlExecutor.retry.Retries = fn.Retry
+	}
+	if fn.Backoff > 0 {
+		sqlExecutor.retry.Backoff = fn.Backoff
+	}
+	sqlExecutor.classifiers = m.Classifiers
+	sqlExecutor.timeout = m.Timeout
+	if fn.Timeout > 0 {
+		sqlExecutor.timeout = fn.Timeout
+	}
+	if shardErr := bindSharding(sqlExecutor, fn, dbs.sharding); shardErr != nil {
+		return emptyReflectValue, linkerror.New(XMLMappedWrong, usedName+"."+f.Name+": "+shardErr.Error())
+	}
+	argTypes := make([]reflect.Type, 0, f.Type.NumIn()-offset)
+	for i := offset; i < f.Type.NumIn(); i++ {
+		argTypes = append(argTypes, f.Type.In(i))
+	}
+	if fn.Key != "" && fn.Type == "select" {
+		if keyErr := sqlExecutor.resolveKey(); keyErr != nil {
+			return emptyReflectValue, linkerror.New(XMLMappedWrong, usedName+"."+f.Name+": "+keyErr.Error())
+		}
+	}
+	if fn.ResultMap != nil {
+		resultMap, compileErr := compileResultMap(fn.ResultMap, findStructType(returnTypes[0]), "")
+		if compileErr != nil {
+			return emptyReflectValue, linkerror.New(XMLMappedWrong, usedName+"."+f.Name+": "+compileErr.Error())
+		}
+		resultType := returnTypes[0]
+		if resultType.Kind() == reflect.Slice {
+			resultType = resultType.Elem()
+		}
+		resultMap.ptr = resultType.Kind() == reflect.Ptr
+		sqlExecutor.resultMap = resultMap
+	}
+	if !needCache {
+		m.addStatement(newMappedStatement(usedName, sqlExecutor, argTypes))
+	}
+	// 所有检查通过后才预编译,Map 失败时不会遗留服务端的预编译语句
+	if m.stmts != nil {
+		sqlExecutor.stmts = m.stmts
+		sqlExecutor.prepareStatic(context.Background(), argTypes)
+	}
 	switch fn.Type {
 	case "select":
 		if needCache {
@@ -308,6 +749,10 @@ func (m *Central) generateFunc(needCache bool, usedName string, fn *Fn, f reflec
 		generatedFunc = reflect.MakeFunc(f.Type, sqlExecutor.Insert)
 	case "execute":
 		generatedFunc = reflect.MakeFunc(f.Type, sqlExecutor.Execute)
+	case "update":
+		generatedFunc = reflect.MakeFunc(f.Type, sqlExecutor.Update)
+	case "delete":
+		generatedFunc = reflect.MakeFunc(f.Type, sqlExecutor.Delete)
 	}
 	return
 }
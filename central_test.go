@@ -0,0 +1,213 @@
+package sago
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	var f File
+	if err := xml.Unmarshal([]byte(`<sago>
+    <type>UserDao</type>
+    <var name="schema">app</var>
+    <select name="FindActive">
+        select * from {{.vars.schema}}.user where status = {{.vars.active}} and region = {{.vars.region}}
+    </select>
+</sago>`), &f); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestCentral(&f)
+	m.SetVar("schema", "global")
+	m.SetVar("active", 1)
+	m.SetVar("region", "'eu'")
+	if err := m.convert(); err != nil {
+		t.Fatal(err)
+	}
+	sqlSet := m.fullNameMap["UserDao"]
+	fn := sqlSet.Functions["FindActive"]
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSQLExecutor("user", "UserDao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	e.Vars = m.mergeVars(sqlSet)
+	sql, _, err := e.executeTpl(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "select * from app.user where status = 1 and region = 'eu'" {
+		t.Error(sql)
+	}
+}
+
+type mapCache map[string]interface{}
+
+func (c mapCache) Set(dir string, key string, v interface{}) {
+	c[dir+key] = v
+}
+
+func (c mapCache) Get(dir string, key string) (v interface{}, ok bool) {
+	v, ok = c[dir+key]
+	return v, ok
+}
+
+type variadicDao struct {
+	DB        *sql.DB
+	Cache     *variadicDao
+	FindByIDs func(ids ...int64) ([]selectSignatureUser, error)
+	FindNames func(prefix string, names ...string) ([]string, error)
+}
+
+func TestVariadic(t *testing.T) {
+	m := newTestCentral(&File{
+		Type: "variadicDao",
+		Selects: []SQLContent{
+			{Name: "FindByIDs", Args: "ids:...int64", SQL: "select {{.fields}} from {{.table}} where id {{in .ids}}"},
+			{Name: "FindNames", Args: "prefix, names:[]string", SQL: "select name from {{.table}} where name {{in .names}}"},
+		},
+	})
+	cache := mapCache{}
+	m.Cache = cache
+	dao := &variadicDao{}
+	if err := m.Map(dao); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := m.fullNameMap["variadicDao"].Functions["FindByIDs"]
+	tpl, _ := m.parseTemplate(fn)
+	e := NewSQLExecutor("user", "variadicDao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	e.variadic = true
+	sqlText, args, err := e.executeTpl([]reflect.Value{reflect.ValueOf([]int64{1, 2})})
+	if err != nil || sqlText != "select  from user where id in (?,?)" || len(args) != 2 {
+		t.Error(sqlText, args, err)
+	}
+	if _, _, err := e.executeTpl([]reflect.Value{reflect.ValueOf([]int64{})}); err == nil {
+		t.Error("expected empty in list to fail")
+	}
+
+	// 缓存命中时不访问数据库
+	cached := []selectSignatureUser{{ID: 1}, {ID: 2}}
+	cache["variadicDao.FindByIDs"+e.cacheKey([]reflect.Value{reflect.ValueOf([]int64{1, 2})})] = cached
+	list, err := dao.Cache.FindByIDs(1, 2)
+	if err != nil || !reflect.DeepEqual(list, cached) {
+		t.Error(list, err)
+	}
+
+	e.Fn = *m.fullNameMap["variadicDao"].Functions["FindNames"]
+	joined := e.cacheKey([]reflect.Value{reflect.ValueOf("x"), reflect.ValueOf([]string{"a b"})})
+	split := e.cacheKey([]reflect.Value{reflect.ValueOf("x"), reflect.ValueOf([]string{"a", "b"})})
+	none := e.cacheKey([]reflect.Value{reflect.ValueOf("x"), reflect.ValueOf([]string(nil))})
+	empty := e.cacheKey([]reflect.Value{reflect.ValueOf("x"), reflect.ValueOf([]string{})})
+	if joined == split || none != empty {
+		t.Error(joined, split, none, empty)
+	}
+}
+
+func TestVariadicArgsDeclaration(t *testing.T) {
+	for args, ok := range map[string]bool{
+		"ids":          true,
+		"ids:...int64": true,
+		"ids:[]int64":  true,
+		"ids:...int":   false,
+	} {
+		m := newTestCentral(&File{
+			Type:    "variadicDao",
+			Selects: []SQLContent{{Name: "FindByIDs", Args: args, SQL: "select 1"}, {Name: "FindNames", Args: "prefix, names:...string", SQL: "select 1"}},
+		})
+		m.Cache = mapCache{}
+		if err := m.Map(&variadicDao{}); (err == nil) != ok {
+			t.Errorf("%s: expected ok=%v, got %v", args, ok, err)
+		}
+	}
+}
+
+type nestedUser struct {
+	ID int64 `db:"id"`
+}
+
+type BaseDao struct {
+	DB    *sql.DB
+	Count func() (int64, error)
+}
+
+type nestedUserDao struct {
+	BaseDao
+	Cache    *nestedUserDao
+	FindByID func(id int64) (*nestedUser, error)
+}
+
+type nestedOrderDao struct {
+	*BaseDao
+	FindAll func() ([]nestedUser, error)
+}
+
+type nestedRepo struct {
+	DB     *sql.DB
+	Users  nestedUserDao
+	Orders *nestedOrderDao
+	Self   *nestedRepo
+	Name   string
+}
+
+func TestNestedAndEmbeddedDao(t *testing.T) {
+	m := newTestCentral(
+		&File{Type: "BaseDao", Selects: []SQLContent{{Name: "Count", SQL: "select count(*) from {{.table}}"}}},
+		&File{Type: "nestedUserDao", Table: "user", Selects: []SQLContent{
+			{Name: "FindByID", Args: "id", SQL: "select * from {{.table}} where id = {{arg .id}}"},
+			{Name: "Count", SQL: "select count(1) from {{.table}}"},
+		}},
+		&File{Type: "nestedOrderDao", Table: "orders", Selects: []SQLContent{{Name: "FindAll", SQL: "select * from {{.table}}"}}},
+	)
+	cache := mapCache{}
+	m.Cache = cache
+	db := &sql.DB{}
+	repo := &nestedRepo{DB: db}
+	if err := m.Map(repo); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Users.FindByID == nil || repo.Users.Count == nil || repo.Orders == nil || repo.Orders.FindAll == nil || repo.Orders.Count == nil {
+		t.Fatalf("funcs not mapped: %+v %+v", repo.Users, repo.Orders)
+	}
+	if repo.Users.DB != db || repo.Orders.DB != db || repo.Users.Cache.DB != db {
+		t.Error("nested DAOs should share the parent DB")
+	}
+	if repo.Self != nil {
+		t.Error("recursive field should not be allocated")
+	}
+
+	// 嵌入的通用函数以外层 DAO 的名称缓存
+	cache["nestedUserDao.Count[]"] = int64(3)
+	if count, err := repo.Users.Cache.Count(); err != nil || count != 3 {
+		t.Error(count, err)
+	}
+}
+
+// 没有 SQL 的结构体字段即使有函数字段也不是 DAO,保持原样
+func TestNestedNonDaoField(t *testing.T) {
+	type hooks struct {
+		OnFind func() (int64, error)
+	}
+	type repo struct {
+		DB     *sql.DB
+		Client *http.Client
+		Hooks  hooks
+		Users  nestedOrderDao
+	}
+	m := newTestCentral(
+		&File{Type: "BaseDao", Selects: []SQLContent{{Name: "Count", SQL: "select count(*) from {{.table}}"}}},
+		&File{Type: "nestedOrderDao", Table: "orders", Selects: []SQLContent{{Name: "FindAll", SQL: "select * from {{.table}}"}}},
+	)
+	r := &repo{DB: &sql.DB{}}
+	if err := m.Map(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Client != nil || r.Hooks.OnFind != nil {
+		t.Errorf("non-DAO fields should be ignored: %+v", r)
+	}
+	if r.Users.FindAll == nil {
+		t.Error("nested DAO not mapped")
+	}
+}
@@ -18,9 +18,22 @@ func clone(value reflect.Value) reflect.Value {
 		}
 		return slice
 	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
 		cp := reflect.New(value.Elem().Type())
 		cp.Elem().Set(clone(value.Elem()))
 		return cp
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		cp := reflect.MakeMapWithSize(value.Type(), value.Len())
+		for _, key := range value.MapKeys() {
+			cp.SetMapIndex(key, clone(value.MapIndex(key)))
+		}
+		return cp
 	}
-	return emptyReflectValue
+	// 基本类型无需复制
+	return value
 }
@@ -0,0 +1,159 @@
+package sago
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	MethodFields       = "fields"
+	MethodFieldsExcept = "fieldsExcept"
+	MethodColumns      = "columns"
+)
+
+// 模型的列,按字段声明顺序
+// 列名取 db tag,没有时为小写的字段名
+// db:"-" 或 sago:"-" 的字段不是列,sago:"readonly" 的列只出现在 {{.fields}}/{{fields}} 中,不出现在 {{columns}} 中
+// 匿名嵌入结构体的列展开到外层,其他结构体字段(如 addr.city)除非实现了 sql.Scanner 或 driver.Valuer,否则不是列
+// 切片(如关联的 []Order)与 map 字段同样不是列,[]byte 除外
+type column struct {
+	name     string
+	readonly bool
+	field    string
+	typ      reflect.Type
+}
+
+var columnsCache sync.Map // reflect.Type -> []column
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+func columnsOf(typ reflect.Type) []column {
+	if cached, ok := columnsCache.Load(typ); ok {
+		return cached.([]column)
+	}
+	columns := appendColumns(nil, typ, map[reflect.Type]bool{})
+	columnsCache.Store(typ, columns)
+	return columns
+}
+
+func appendColumns(columns []column, typ reflect.Type, visiting map[reflect.Type]bool) []column {
+	if visiting[typ] {
+		return columns
+	}
+	visiting[typ] = true
+	defer delete(visiting, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		dbTag := f.Tag.Get("db")
+		sagoTag := f.Tag.Get("sago")
+		if dbTag == "-" || sagoTag == "-" {
+			continue
+		}
+		fieldType := f.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if f.Anonymous && dbTag == "" && fieldType.Kind() == reflect.Struct && !isColumnStruct(fieldType) {
+			columns = appendColumns(columns, fieldType, visiting)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if (fieldType.Kind() == reflect.Struct || fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Map) && !isColumnStruct(fieldType) {
+			continue
+		}
+		name := dbTag
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		columns = append(columns, column{name: name, readonly: sagoTag == "readonly", field: f.Name, typ: f.Type})
+	}
+	return columns
+}
+
+// 作为单个列读写的结构体、切片或 map,切片中只有 []byte 是列
+func isColumnStruct(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+		return true
+	}
+	return typ == timeType || reflect.PtrTo(typ).Implements(scannerType) || typ.Implements(valuerType)
+}
+
+// 以 `` 引用的列名列表,alias 不为空时加上表别名
+func joinColumns(columns []column, alias string, skip func(column) bool) string {
+	var b strings.Builder
+	for _, c := range columns {
+		if skip != nil && skip(c) {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		if alias != "" {
+			b.WriteString(quoteIdent(alias))
+			b.WriteByte('.')
+		}
+		b.WriteString(quoteIdent(c.name))
+	}
+	return b.String()
+}
+
+// {{columns .x}} 列出 x 的类型中可写的列
+func columnsFunc(v interface{}) (string, error) {
+	typ := reflect.TypeOf(v)
+	if typ != nil {
+		typ = findStructType(typ)
+	}
+	if typ == nil {
+		return "", fmt.Errorf("sago: columns expects a struct, got %T", v)
+	}
+	return joinColumns(columnsOf(typ), "", func(c column) bool { return c.readonly }), nil
+}
+
+var errNoModel = errors.New("sago: fields needs a struct return type")
+
+// 解析模板时 fields/fieldsExcept 的占位函数,渲染时绑定到语句的模型
+var modelFuncPlaceholders = template.FuncMap{
+	MethodFields:       func(alias ...string) (string, error) { return "", errNoModel },
+	MethodFieldsExcept: func(names ...string) (string, error) { return "", errNoModel },
+}
+
+// {{fields "u"}} 以表别名列出模型的列,{{fieldsExcept "password"}} 排除指定的列
+func modelFuncs(model reflect.Type) template.FuncMap {
+	if model == nil {
+		return modelFuncPlaceholders
+	}
+	columns := columnsOf(model)
+	return template.FuncMap{
+		MethodFields: func(alias ...string) (string, error) {
+			if len(alias) > 1 {
+				return "", errors.New("sago: fields takes at most one alias")
+			}
+			if len(alias) == 0 {
+				return joinColumns(columns, "", nil), nil
+			}
+			return joinColumns(columns, alias[0], nil), nil
+		},
+		MethodFieldsExcept: func(names ...string) (string, error) {
+			excluded := map[string]bool{}
+			for _, name := range names {
+				for _, n := range strings.Split(name, ",") {
+					excluded[strings.TrimSpace(n)] = true
+				}
+			}
+			return joinColumns(columns, "", func(c column) bool { return excluded[c.name] }), nil
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package sago
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type columnsBase struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at" sago:"readonly"`
+}
+
+type columnsAddress struct {
+	City string `db:"city"`
+}
+
+type columnsOrder struct {
+	ID int64 `db:"id"`
+}
+
+// 以 driver.Valuer 写为单个列的切片
+type columnsLabels []string
+
+func (l columnsLabels) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// 关联的切片与 map 不是列,[]byte 与实现了 driver.Valuer 的切片是列
+type columnsUserWithOrders struct {
+	ID     int64  `db:"id"`
+	Avatar []byte `db:"avatar"`
+	Tags   []string
+	Orders []columnsOrder
+	Extra  map[string]string
+	Labels columnsLabels `db:"labels"`
+}
+
+type columnsUser struct {
+	columnsBase
+	Name     string         `db:"name"`
+	Password string         `db:"password"`
+	Nickname sql.NullString `db:"nickname"`
+	Email    string
+	Addr     columnsAddress `db:"addr"`
+	Cache    *columnsUser   `db:"-"`
+	Secret   string         `sago:"-"`
+	internal string
+}
+
+func TestColumnsOf(t *testing.T) {
+	var names []string
+	for _, c := range columnsOf(reflect.TypeOf(columnsUser{})) {
+		names = append(names, c.name)
+	}
+	if got := strings.Join(names, ","); got != "id,created_at,name,password,nickname,email" {
+		t.Errorf("columns = %s", got)
+	}
+
+	names = nil
+	for _, c := range columnsOf(reflect.TypeOf(columnsUserWithOrders{})) {
+		names = append(names, c.name)
+	}
+	if got := strings.Join(names, ","); got != "id,avatar,labels" {
+		t.Errorf("columns = %s", got)
+	}
+}
+
+func TestColumnFuncs(t *testing.T) {
+	m := New()
+	fn := &Fn{Name: "F", Args: []string{"u"}, SQL: "{{.fields}}|{{fields \"u\"}}|{{fieldsExcept \"password,email\"}}|{{columns .u}}"}
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSQLExecutor("user", "dao", []reflect.Type{reflect.TypeOf([]*columnsUser{}), emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	sqlText, _, err := e.executeTpl([]reflect.Value{reflect.ValueOf(&columnsUser{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"`id`,`created_at`,`name`,`password`,`nickname`,`email`",
+		"`u`.`id`,`u`.`created_at`,`u`.`name`,`u`.`password`,`u`.`nickname`,`u`.`email`",
+		"`id`,`created_at`,`name`,`nickname`",
+		"`id`,`name`,`password`,`nickname`,`email`",
+	}, "|")
+	if sqlText != expected {
+		t.Errorf("got\n%s\nexpected\n%s", sqlText, expected)
+	}
+	// {{columns .u}} 依赖参数
+	if isStaticTemplate(tpl) {
+		t.Error("columns should not be static")
+	}
+}
+
+func TestFieldsWithoutModel(t *testing.T) {
+	m := New()
+	fn := &Fn{Name: "F", SQL: "insert into t ({{fields}}) values (1)"}
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSQLExecutor("t", "dao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	if _, _, err := e.executeTpl(nil); err == nil {
+		t.Error("expected error for fields without model")
+	}
+	if _, err := columnsFunc(1); err == nil {
+		t.Error("expected error for columns of int")
+	}
+}
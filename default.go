@@ -19,3 +19,7 @@ func MustMap(obj interface{}) {
 func AddFunc(name string, fnFactory func(ctx *FnCtx) (fn TemplateFunc)) {
 	DefaultManager.AddFunc(name, fnFactory)
 }
+
+func SetVar(name string, value interface{}) {
+	DefaultManager.SetVar(name, value)
+}
@@ -0,0 +1,213 @@
+package sago
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// <select>/<execute> 等语句中的动态元素在 convert() 时编译为模板
+//	<if test=".name">and name = {{arg .name}}</if>     {{if .name}}...{{end}}
+//	<foreach collection="ids" item="id" separator=",">  {{range $index, $id := .ids}}...{{end}}
+//	<where>/<set>/<trim>                               渲染后再处理前缀与后缀
+// <where>/<set>/<trim> 的内容在模板中以标记包裹,executeTpl 渲染后由 applyTrims 处理
+const (
+	trimOpen  = "\x00"
+	trimSep   = "\x1f"
+	trimBody  = "\x01"
+	trimClose = "\x02"
+)
+
+type trimRule struct {
+	prefix          string
+	suffix          string
+	prefixOverrides string
+	suffixOverrides string
+}
+
+var (
+	whereRule = trimRule{prefix: "WHERE", prefixOverrides: "AND |OR "}
+	setRule   = trimRule{prefix: "SET", suffixOverrides: ","}
+)
+
+func (r trimRule) open() string {
+	return trimOpen + strings.Join([]string{r.prefix, r.suffix, r.prefixOverrides, r.suffixOverrides}, trimSep) + trimBody
+}
+
+func attr(e xml.StartElement, name, defaultValue string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return defaultValue
+}
+
+// 将语句的 innerxml 编译为模板文本
+func compileDynamic(inner string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<sql>" + inner + "</sql>"))
+	buf := &strings.Builder{}
+	var closers []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			if len(closers) > 0 {
+				buf.Write(t)
+			}
+		case xml.EndElement:
+			buf.WriteString(closers[len(closers)-1])
+			closers = closers[:len(closers)-1]
+		case xml.StartElement:
+			closer, err := compileElement(buf, t, len(closers) == 0)
+			if err != nil {
+				return "", err
+			}
+			closers = append(closers, closer)
+		}
+	}
+	return buf.String(), nil
+}
+
+func compileElement(buf *strings.Builder, e xml.StartElement, root bool) (closer string, err error) {
+	if root {
+		return "", nil
+	}
+	switch e.Name.Local {
+	case "if":
+		test := attr(e, "test", "")
+		if test == "" {
+			return "", fmt.Errorf("<if> needs a test attribute")
+		}
+		buf.WriteString("{{if " + test + "}}")
+		return "{{end}}", nil
+	case "where":
+		buf.WriteString(whereRule.open())
+		return trimClose, nil
+	case "set":
+		buf.WriteString(setRule.open())
+		return trimClose, nil
+	case "trim":
+		buf.WriteString(trimRule{
+			prefix:          attr(e, "prefix", ""),
+			suffix:          attr(e, "suffix", ""),
+			prefixOverrides: attr(e, "prefixOverrides", ""),
+			suffixOverrides: attr(e, "suffixOverrides", ""),
+		}.open())
+		return trimClose, nil
+	case "foreach":
+		collection := attr(e, "collection", "")
+		if collection == "" {
+			return "", fmt.Errorf("<foreach> needs a collection attribute")
+		}
+		if !strings.HasPrefix(collection, ".") && !strings.HasPrefix(collection, "$") {
+			collection = "." + collection
+		}
+		item := "$" + attr(e, "item", "item")
+		index := "$" + attr(e, "index", "index")
+		separator := attr(e, "separator", "")
+		if separator == "" {
+			buf.WriteString(attr(e, "open", "") + "{{range " + index + ", " + item + " := " + collection + "}}")
+			return "{{end}}" + attr(e, "close", ""), nil
+		}
+		// map 的 index 为 key,以首次迭代标记决定是否输出分隔符
+		buf.WriteString(attr(e, "open", "") + "{{$sagoFirst := true}}{{range " + index + ", " + item + " := " + collection + "}}" +
+			"{{if $sagoFirst}}{{$sagoFirst = false}}{{else}}" + separator + "{{end}}")
+		return "{{end}}" + attr(e, "close", ""), nil
+	}
+	return "", fmt.Errorf("unsupported element <%s>", e.Name.Local)
+}
+
+// 由内向外处理渲染结果中的 <where>/<set>/<trim> 标记
+// 标记不成对(如参数或 vars 中带有标记字符)时返回错误
+var errTrimMarkers = errors.New("sago: unbalanced <where>/<set>/<trim> markers in rendered sql")
+
+func applyTrims(sql string) (string, error) {
+	for {
+		end := strings.Index(sql, trimClose)
+		if end < 0 {
+			if strings.Contains(sql, trimOpen) || strings.Contains(sql, trimBody) {
+				return "", errTrimMarkers
+			}
+			return sql, nil
+		}
+		start := strings.LastIndex(sql[:end], trimOpen)
+		if start < 0 {
+			return "", errTrimMarkers
+		}
+		body := strings.Index(sql[start:end], trimBody)
+		if body < 0 {
+			return "", errTrimMarkers
+		}
+		body += start
+		rule := strings.Split(sql[start+len(trimOpen):body], trimSep)
+		if len(rule) != 4 {
+			return "", errTrimMarkers
+		}
+		trimmed := trimRule{prefix: rule[0], suffix: rule[1], prefixOverrides: rule[2], suffixOverrides: rule[3]}.apply(sql[body+len(trimBody) : end])
+		sql = sql[:start] + trimmed + sql[end+len(trimClose):]
+	}
+}
+
+func (r trimRule) apply(body string) string {
+	body = strings.TrimSpace(body)
+	if r.prefixOverrides != "" {
+		for _, override := range strings.Split(r.prefixOverrides, "|") {
+			if n := matchPrefix(body, override); n > 0 {
+				body = strings.TrimSpace(body[n:])
+				break
+			}
+		}
+	}
+	if r.suffixOverrides != "" {
+		for _, override := range strings.Split(r.suffixOverrides, "|") {
+			if n := matchSuffix(body, override); n > 0 {
+				body = strings.TrimSpace(body[:len(body)-n])
+				break
+			}
+		}
+	}
+	if body == "" {
+		return " "
+	}
+	result := body
+	if r.prefix != "" {
+		result = r.prefix + " " + result
+	}
+	if r.suffix != "" {
+		result = result + " " + r.suffix
+	}
+	return " " + result + " "
+}
+
+// 忽略大小写匹配,override 以空格结尾时要求其后为空白
+func matchPrefix(s, override string) int {
+	word := strings.TrimSpace(override)
+	if word == "" || len(s) < len(word) || !strings.EqualFold(s[:len(word)], word) {
+		return 0
+	}
+	if strings.HasSuffix(override, " ") && len(s) > len(word) && !unicode.IsSpace(rune(s[len(word)])) {
+		return 0
+	}
+	return len(word)
+}
+
+func matchSuffix(s, override string) int {
+	word := strings.TrimSpace(override)
+	if word == "" || len(s) < len(word) || !strings.EqualFold(s[len(s)-len(word):], word) {
+		return 0
+	}
+	if strings.HasPrefix(override, " ") && len(s) > len(word) && !unicode.IsSpace(rune(s[len(s)-len(word)-1])) {
+		return 0
+	}
+	return len(word)
+}
@@ -0,0 +1,140 @@
+package sago
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 渲染 fn,返回 SQL 与参数
+func renderTestFn(t *testing.T, m *Central, fn *Fn, args ...interface{}) (string, []interface{}) {
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		values[i] = reflect.ValueOf(arg)
+	}
+	e := NewSQLExecutor("user", "UserDao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	sql, sqlArgs, err := e.executeTpl(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(strings.Fields(sql), " "), sqlArgs
+}
+
+func TestDynamicElements(t *testing.T) {
+	var f File
+	err := xml.Unmarshal([]byte(`<sago>
+    <type>UserDao</type>
+    <select name="Search" args="name,ids,age">
+        select * from {{.table}}
+        <where>
+            <if test=".name">and `+"`name`"+` = {{arg .name}}</if>
+            <if test=".ids">
+                AND id in <foreach collection="ids" item="id" open="(" close=")" separator=",">{{arg $id}}</foreach>
+            </if>
+            <if test=".age">or age &gt; {{arg .age}}</if>
+        </where>
+    </select>
+    <update name="Patch" args="id,name,age">
+        update {{.table}}
+        <set>
+            <if test=".name">`+"`name`"+` = {{arg .name}},</if>
+            <if test=".age">age = {{arg .age}},</if>
+        </set>
+        where id = {{arg .id}}
+    </update>
+    <select name="Keys" args="m,ids">
+        select 1 where k in <foreach collection="m" index="k" item="v" open="(" close=")" separator=",">{{arg $k}}</foreach>
+        and id in <foreach collection="ids" item="id" open="(" close=")" separator=",">{{arg $id}}</foreach>
+    </select>
+    <select name="Groups" args="groups">
+        select 1 where <foreach collection="groups" item="g" separator=" or ">id in (<foreach collection="$g" item="id" separator=",">{{arg $id}}</foreach>)</foreach>
+    </select>
+    <select name="Trimmed" args="a">
+        select 1 <trim prefix="HAVING (" suffix=")" prefixOverrides="AND " suffixOverrides=" AND"><if test=".a">and a = {{arg .a}} AND</if></trim>
+    </select>
+</sago>`), &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestCentral(&f)
+	if err := m.convert(); err != nil {
+		t.Fatal(err)
+	}
+	fns := m.fullNameMap["UserDao"].Functions
+
+	for _, c := range []struct {
+		fn     string
+		args   []interface{}
+		sql    string
+		params int
+	}{
+		{"Search", []interface{}{"", []int(nil), 0}, "select * from user", 0},
+		{"Search", []interface{}{"foo", []int(nil), 0}, "select * from user WHERE `name` = ?", 1},
+		{"Search", []interface{}{"", []int{1, 2, 3}, 0}, "select * from user WHERE id in (?,?,?)", 3},
+		{"Search", []interface{}{"", []int(nil), 18}, "select * from user WHERE age > ?", 1},
+		{"Search", []interface{}{"foo", []int{1}, 18}, "select * from user WHERE `name` = ? AND id in (?) or age > ?", 3},
+		{"Patch", []interface{}{1, "foo", 0}, "update user SET `name` = ? where id = ?", 2},
+		{"Patch", []interface{}{1, "foo", 3}, "update user SET `name` = ?, age = ? where id = ?", 3},
+		{"Keys", []interface{}{map[string]int{"a": 1, "b": 2}, []int{0, 1}}, "select 1 where k in (?,?) and id in (?,?)", 4},
+		{"Keys", []interface{}{map[int]int{0: 1, 1: 2, 2: 3}, []int{5}}, "select 1 where k in (?,?,?) and id in (?)", 4},
+		{"Groups", []interface{}{[][]int{{1, 2}, {3}}}, "select 1 where id in (?,?) or id in (?)", 3},
+		{"Trimmed", []interface{}{1}, "select 1 HAVING ( a = ? )", 1},
+		{"Trimmed", []interface{}{0}, "select 1", 0},
+	} {
+		sql, params := renderTestFn(t, m, fns[c.fn], c.args...)
+		if sql != c.sql || len(params) != c.params {
+			t.Errorf("%s%v: got %q %v, expected %q", c.fn, c.args, sql, params, c.sql)
+		}
+	}
+}
+
+func TestDynamicElementErrors(t *testing.T) {
+	for _, inner := range []string{
+		`select 1 <if>x</if>`,
+		`select 1 <foreach item="x"></foreach>`,
+		`select 1 <choose></choose>`,
+	} {
+		if _, err := compileDynamic(inner); err == nil {
+			t.Errorf("expected error for %s", inner)
+		}
+	}
+}
+
+func TestApplyTrimsUnbalanced(t *testing.T) {
+	where := whereRule.open()
+	for _, sql := range []string{
+		"select 1 " + trimClose,
+		"select 1 " + trimOpen,
+		"select 1 " + trimOpen + "WHERE" + trimClose,
+		"select 1 " + trimOpen + "WHERE" + trimBody + "a = 1" + trimClose,
+		"select 1 " + where + "and a = '" + trimClose + "'" + trimClose,
+		"select 1 " + where + "and a = '" + trimOpen + "'" + trimClose,
+	} {
+		if _, err := applyTrims(sql); err == nil {
+			t.Errorf("expected error for %q", sql)
+		}
+	}
+	sql, err := applyTrims("select 1 " + where + "and a = 1" + trimClose)
+	if err != nil || strings.TrimSpace(sql) != "select 1  WHERE a = 1" {
+		t.Errorf("got %q %v", sql, err)
+	}
+
+	// vars 中的标记字符在渲染后不成对
+	m := newTestCentral(&File{Type: "UserDao"})
+	m.SetVar("x", trimClose)
+	fn := &Fn{Name: "F", SQL: "select 1 " + where + "and a = '{{.vars.x}}'" + trimClose}
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSQLExecutor("user", "UserDao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	e.Vars = m.vars
+	if _, _, err := e.executeTpl(nil); err != errTrimMarkers {
+		t.Errorf("expected errTrimMarkers, got %v", err)
+	}
+}
@@ -1,5 +1,10 @@
 package sago
 
+import "errors"
+
+// update/delete 声明了 mustAffect 但没有影响任何行
+var ErrNotFound = errors.New("sago: no rows affected")
+
 type errorSago int
 
 const (
@@ -0,0 +1,4 @@
+create table user (
+    id integer primary key autoincrement,
+    name text not null
+);
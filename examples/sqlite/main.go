@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mengxiaozhu/sago"
+)
+
+var logger = log.New(os.Stdout, "[examples] ", log.Lshortfile)
+
+// 并发安全的内存缓存,用于缓存select结果
+type MapCache struct {
+	sync.Mutex
+	cache map[string]interface{}
+}
+
+func (c *MapCache) Set(dir string, key string, v interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.cache[dir+key] = v
+}
+
+func (c *MapCache) Get(dir string, key string) (v interface{}, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	v, ok = c.cache[dir+key]
+	return v, ok
+}
+
+type User struct {
+	Id   int64  `db:"id" sago:"readonly"` // insert 后回填
+	Name string `db:"name"`
+}
+
+type UserDao struct {
+	DB         *sql.DB                                    // 名称必须是DB
+	Cache      *UserDao                                   // 名字必须是Cache
+	Insert     func(u *User) error                        // user.sql.xml
+	FindByName func(name string) (*User, bool, error)     // user.sql.xml
+	Rename     func(id int64, name string) (int64, error) // user.sql.xml
+	FindAll    func() ([]User, error)                     // user.sql.yaml
+	Count      func() (int, error)                        // user.sql.yaml
+}
+
+// 不依赖外部数据库,在临时目录中创建 SQLite 数据库运行
+// go run ./examples/sqlite (需要 cgo)
+func main() {
+	dir, err := ioutil.TempDir("", "sago-example")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "example.db"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	central := sago.New()
+	// 读取 xml、yaml 以及 001_create_user.up.sql 迁移
+	err = central.ScanDir("./examples/sqlite")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// 建表
+	applied, err := central.Migrate(context.Background(), db)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	for _, m := range applied {
+		logger.Println("applied", m.Version, m.Name)
+	}
+
+	central.Cache = &MapCache{
+		cache: map[string]interface{}{},
+	}
+	dao := &UserDao{
+		DB: db,
+	}
+	err = central.Map(dao)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	sago.ShowSQL = true
+
+	for _, name := range []string{"foo", "bar"} {
+		u := &User{Name: name}
+		if err := dao.Insert(u); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Println("inserted", u.Id, u.Name)
+	}
+
+	u, ok, err := dao.Cache.FindByName("bar")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Println(u, ok)
+
+	affected, err := dao.Rename(u.Id, "baz")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Println("renamed", affected)
+
+	// 缓存中仍是改名前的结果
+	u, ok, err = dao.Cache.FindByName("bar")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Println(u, ok)
+
+	list, err := dao.FindAll()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Println(list)
+
+	count, err := dao.Count()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Println("count", count)
+
+	issues, err := central.VerifySchema(context.Background())
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Println("schema issues", issues)
+}
@@ -3,13 +3,39 @@ package sago
 import (
 	"encoding/xml"
 	"errors"
+	"time"
+
 	"github.com/mengxiaozhu/linkerror"
 )
 
 type SQLContent struct {
-	Name string `xml:"name,attr"`
-	Args string `xml:"args,attr"`
-	SQL  string `xml:",chardata"`
+	Name       string `xml:"name,attr"`
+	Args       string `xml:"args,attr"`
+	MustAffect bool   `xml:"mustAffect,attr" yaml:"mustAffect"`
+	Key        string `xml:"key,attr" yaml:"key"`
+	ResultMap  string `xml:"resultMap,attr" yaml:"resultMap"`
+	ShardKey   string `xml:"shardKey,attr" yaml:"shardKey"`
+	Retry      int    `xml:"retry,attr" yaml:"retry"`
+	Backoff    string `xml:"backoff,attr" yaml:"backoff"`
+	Idempotent bool   `xml:"idempotent,attr" yaml:"idempotent"`
+	Timeout    string `xml:"timeout,attr" yaml:"timeout"`
+	SQL        string `xml:",chardata"`
+	// XML 中包含 <if>/<where>/<foreach> 等动态元素时的原始内容
+	Inner string `xml:",innerxml" yaml:"-"`
+}
+
+// 联表查询结果到嵌套结构体的映射
+// <resultMap id="userWithOrders" idColumn="id">
+//	<collection property="Orders" prefix="order_" idColumn="id"/>
+//	<association property="Profile" prefix="profile_"/>
+// </resultMap>
+type ResultMapContent struct {
+	ID           string             `xml:"id,attr" yaml:"id"`
+	Property     string             `xml:"property,attr" yaml:"property"`
+	Prefix       string             `xml:"prefix,attr" yaml:"prefix"`
+	IDColumn     string             `xml:"idColumn,attr" yaml:"idColumn"`
+	Collections  []ResultMapContent `xml:"collection" yaml:"collections"`
+	Associations []ResultMapContent `xml:"association" yaml:"associations"`
 }
 
 type File struct {
@@ -20,6 +46,19 @@ type File struct {
 	Selects  []SQLContent `xml:"select"`
 	Executes []SQLContent `xml:"execute"`
 	Inserts  []SQLContent `xml:"insert"`
+	Updates  []SQLContent `xml:"update"`
+	Deletes  []SQLContent `xml:"delete"`
+
+	ResultMaps []ResultMapContent `xml:"resultMap" yaml:"resultMaps"`
+	Fragments  []FragmentContent  `xml:"sql" yaml:"fragments"`
+	Vars       []VarContent       `xml:"var" yaml:"vars"`
+	Migrations []MigrationContent `xml:"migration" yaml:"migrations"`
+}
+
+// 模板变量 <var name="schema">app</var>,语句中以 {{.vars.schema}} 使用
+type VarContent struct {
+	Name  string `xml:"name,attr" yaml:"name"`
+	Value string `xml:",chardata" yaml:"value"`
 }
 
 func (f File) Name() string {
@@ -34,25 +73,49 @@ type Fn struct {
 	Type string
 	SQL  string
 	Args []string
+	// args 中声明的参数类型,未声明时为空字符串
+	ArgTypes []string
+	// update/delete 未影响任何行时返回 ErrNotFound
+	MustAffect bool
+	// select 返回 map 时作为 key 的列名或字段名
+	Key string
+	// select 使用的 <resultMap>
+	ResultMap *ResultMapContent
+	// 选择分片的参数名
+	ShardKey string
+	// 临时错误的重试次数与初始等待时间,为 0 时使用 Central.Retry
+	Retry   int
+	Backoff time.Duration
+	// 写语句可以安全重试
+	Idempotent bool
+	// 语句的超时,为 0 时使用 Central.Timeout
+	Timeout time.Duration
 }
 
 type SQLSet struct {
 	Package   string
 	Type      string
 	Table     string
+	Vars      map[string]string
 	Functions map[string]*Fn
 }
 
 var FileConflict = errors.New("file conflict")
 
 func combineFiles(r1, r2 *File) (r *File, err *linkerror.Error) {
-	r = &File{Table: r1.Table}
+	r = &File{Package: r1.Package, Type: r1.Type, Table: r1.Table}
 	if r2.Table != r1.Table {
 		return nil, linkerror.New(FileConflict, r.Package+"."+r.Type+" conflict "+r2.Table+"!="+r1.Table)
 	}
 	r.Executes = combineSQLContent(r1.Executes, r2.Executes)
 	r.Selects = combineSQLContent(r1.Selects, r2.Selects)
 	r.Inserts = combineSQLContent(r1.Inserts, r2.Inserts)
+	r.Updates = combineSQLContent(r1.Updates, r2.Updates)
+	r.Deletes = combineSQLContent(r1.Deletes, r2.Deletes)
+	r.ResultMaps = append(append([]ResultMapContent{}, r1.ResultMaps...), r2.ResultMaps...)
+	r.Fragments = append(append([]FragmentContent{}, r1.Fragments...), r2.Fragments...)
+	r.Vars = append(append([]VarContent{}, r1.Vars...), r2.Vars...)
+	r.Migrations = append(append([]MigrationContent{}, r1.Migrations...), r2.Migrations...)
 	return
 }
 
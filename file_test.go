@@ -0,0 +1,75 @@
+package sago
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "sago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseUpdateDelete(t *testing.T) {
+	xmlPath := writeTempFile(t, "user.sql.xml", `<sago>
+    <type>UserDao</type>
+    <update name="Rename" args="id,name" mustAffect="true">
+        update {{.table}} set name = {{arg .name}} where id = {{arg .id}}
+    </update>
+    <delete name="Remove" args="id">
+        delete from {{.table}} where id = {{arg .id}}
+    </delete>
+</sago>`)
+	defer os.RemoveAll(filepath.Dir(xmlPath))
+	yamlPath := writeTempFile(t, "user.sql.yaml", `
+type: UserDao
+updates:
+  - name: Touch
+    args: id
+    mustAffect: true
+    sql: update {{.table}} set updated = now() where id = {{arg .id}}
+deletes:
+  - name: Purge
+    sql: delete from {{.table}}
+`)
+	defer os.RemoveAll(filepath.Dir(yamlPath))
+
+	x, err := parseXML(xmlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := parseYAML(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Updates) != 1 || !x.Updates[0].MustAffect || len(x.Deletes) != 1 || x.Deletes[0].MustAffect {
+		t.Fatalf("xml parsed wrong: %+v", x)
+	}
+	if len(y.Updates) != 1 || !y.Updates[0].MustAffect || len(y.Deletes) != 1 {
+		t.Fatalf("yaml parsed wrong: %+v", y)
+	}
+
+	m := New()
+	m.files = append(m.files, x, y)
+	if err := m.convert(); err != nil {
+		t.Fatal(err)
+	}
+	fns := m.fullNameMap["UserDao"].Functions
+	for name, typ := range map[string]string{"Rename": "update", "Touch": "update", "Remove": "delete", "Purge": "delete"} {
+		if fns[name] == nil || fns[name].Type != typ {
+			t.Errorf("%s: expected %s, got %+v", name, typ, fns[name])
+		}
+	}
+	if !fns["Rename"].MustAffect || fns["Remove"].MustAffect {
+		t.Error("mustAffect not carried into Fn")
+	}
+}
@@ -0,0 +1,70 @@
+package sago
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/mengxiaozhu/linkerror"
+)
+
+// 可复用的 SQL 片段
+// <sql id="userColumns">`id`,`name`</sql>
+// 语句中以 {{include "userColumns"}} 引用本文件的片段
+// 或以 {{include "common.softDeleteFilter"}} 引用其他文件(<package>.<type>)的片段
+type FragmentContent struct {
+	ID    string `xml:"id,attr" yaml:"id"`
+	SQL   string `xml:",chardata" yaml:"sql"`
+	Inner string `xml:",innerxml" yaml:"-"`
+}
+
+var includePattern = regexp.MustCompile(`\{\{-?\s*include\s+"([^"]+)"\s*-?\}\}`)
+
+const maxIncludeDepth = 16
+
+// 收集全部文件的片段,key 为 文件名.片段id
+func collectFragments(files map[string]*File) (map[string]string, *linkerror.Error) {
+	fragments := map[string]string{}
+	for name, f := range files {
+		for _, fragment := range f.Fragments {
+			sqlText := fragment.SQL
+			if strings.Contains(fragment.Inner, "<") {
+				compiled, err := compileDynamic(fragment.Inner)
+				if err != nil {
+					return nil, linkerror.New(BadSQLTemplate, name+"."+fragment.ID+": "+err.Error())
+				}
+				sqlText = compiled
+			}
+			fragments[name+"."+fragment.ID] = strings.TrimSpace(sqlText)
+		}
+	}
+	return fragments, nil
+}
+
+// 展开 sqlText 中的 {{include}},fileName 为 sqlText 所在的文件
+func expandIncludes(fragments map[string]string, fileName string, sqlText string, depth int) (string, error) {
+	var expandErr error
+	expanded := includePattern.ReplaceAllStringFunc(sqlText, func(action string) string {
+		if expandErr != nil {
+			return action
+		}
+		ref := includePattern.FindStringSubmatch(action)[1]
+		fullName := fileName + "." + ref
+		fragment, ok := fragments[fullName]
+		if !ok {
+			fullName = ref
+			fragment, ok = fragments[fullName]
+		}
+		if !ok {
+			expandErr = errors.New("sql fragment " + ref + " not found")
+			return action
+		}
+		if depth >= maxIncludeDepth {
+			expandErr = errors.New("sql fragment " + ref + " includes too deep, maybe cyclic")
+			return action
+		}
+		fragment, expandErr = expandIncludes(fragments, fullName[:strings.LastIndex(fullName, ".")], fragment, depth+1)
+		return fragment
+	})
+	return expanded, expandErr
+}
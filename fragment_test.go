@@ -0,0 +1,54 @@
+package sago
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	var user, common File
+	if err := xml.Unmarshal([]byte(`<sago>
+    <type>UserDao</type>
+    <sql id="userColumns">`+"`id`,`name`"+`</sql>
+    <sql id="active">status = 1 and {{include "common.softDeleteFilter"}}</sql>
+    <select name="FindActive" args="name">
+        select {{include "userColumns"}} from {{.table}}
+        <where>
+            <if test=".name">and name = {{arg .name}}</if>
+            and {{ include "active" }}
+        </where>
+    </select>
+</sago>`), &user); err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal([]byte(`<sago>
+    <type>common</type>
+    <sql id="softDeleteFilter">deleted_at is null</sql>
+</sago>`), &common); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestCentral(&user, &common)
+	if err := m.convert(); err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := renderTestFn(t, m, m.fullNameMap["UserDao"].Functions["FindActive"], "")
+	if sql != "select `id`,`name` from user WHERE status = 1 and deleted_at is null" {
+		t.Error(sql)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	for _, fragments := range []FragmentContent{
+		{ID: "a", SQL: `{{include "missing"}}`},
+		{ID: "a", SQL: `{{include "a"}}`},
+	} {
+		m := newTestCentral(&File{
+			Type:      "UserDao",
+			Fragments: []FragmentContent{fragments},
+			Selects:   []SQLContent{{Name: "Find", SQL: `select {{include "a"}}`}},
+		})
+		if err := m.convert(); err == nil {
+			t.Errorf("expected error for %+v", fragments)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package integration_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mengxiaozhu/sago"
+)
+
+type User struct {
+	ID   int64  `db:"id" sago:"readonly"`
+	Name string `db:"name"`
+	Age  int    `db:"age"`
+}
+
+type Order struct {
+	ID     int64   `db:"id" sago:"readonly"`
+	UserID int64   `db:"user_id"`
+	Amount float64 `db:"amount"`
+}
+
+type UserWithOrders struct {
+	ID     int64  `db:"id"`
+	Name   string `db:"name"`
+	Orders []Order
+}
+
+type UserDao struct {
+	DB       *sql.DB
+	Cache    *UserDao
+	Insert   func(u *User) error
+	FindByID func(id int64) (*User, error)
+	Find     func(id int64) (User, bool, error)
+	FindAll  func() ([]User, error)
+	FindPtrs func() ([]*User, error)
+	Count    func() (int64, error)
+	Names    func() ([]string, error)
+	Row      func(id int64) (map[string]interface{}, error)
+	Rows     func() ([]map[string]interface{}, error)
+	Table    func() ([][]interface{}, error)
+	ByIDs    func(ids ...int64) (map[int64]User, error)
+	ByAge    func() (map[int][]*User, error)
+	Search   func(name string, ids []int64) ([]User, error)
+	Rename   func(id int64, name string) (int64, error)
+	SetAge   func(age int) (sql.Result, error)
+	Remove   func(id int64) (bool, error)
+}
+
+type OrderDao struct {
+	DB              *sql.DB
+	Insert          func(ctx context.Context, o *Order) (int64, int64, error)
+	ByUser          func(ctx context.Context, userIDs []int64) (map[int64][]Order, error)
+	Total           func(userID int64) (float64, error)
+	UsersWithOrders func() ([]*UserWithOrders, error)
+}
+
+// 线程安全的内存缓存,用于验证 Cache 路径
+type mapCache struct {
+	sync.Mutex
+	values map[string]interface{}
+	hits   int
+}
+
+func (c *mapCache) Set(dir string, key string, v interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[dir+"|"+key] = v
+}
+
+func (c *mapCache) Get(dir string, key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.values[dir+"|"+key]
+	if ok {
+		c.hits++
+	}
+	return v, ok
+}
+
+type fixture struct {
+	central *sago.Central
+	db      *sql.DB
+	cache   *mapCache
+	users   *UserDao
+	orders  *OrderDao
+}
+
+// 设置后 SQLite 不可用时测试失败而不是跳过,用于必须运行集成测试的流水线
+const requireSQLiteEnv = "SAGO_REQUIRE_SQLITE"
+
+// 在临时目录中打开 SQLite
+// 未启用 cgo 时 go-sqlite3 无法工作,以 t.Skip 说明原因跳过,设置 SAGO_REQUIRE_SQLITE 时失败
+func openSQLite(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "sago-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		reason := "sqlite3 unavailable, the integration tests need cgo (CGO_ENABLED=1 and a C compiler): " + err.Error()
+		if os.Getenv(requireSQLiteEnv) != "" {
+			t.Fatal(reason)
+		}
+		t.Skip(reason + "; set " + requireSQLiteEnv + "=1 to fail instead")
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// 执行 testdata 中的迁移并 Map 两个 DAO
+func setup(t *testing.T) (*fixture, func()) {
+	db, teardown := openSQLite(t)
+	f := &fixture{
+		central: sago.New(),
+		db:      db,
+		cache:   &mapCache{values: map[string]interface{}{}},
+	}
+	if err := f.central.ScanDir("testdata"); err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+	if _, err := f.central.Migrate(context.Background(), db); err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+	f.central.Cache = f.cache
+	f.users = &UserDao{DB: db, Cache: &UserDao{}}
+	f.orders = &OrderDao{DB: db}
+	if err := f.central.Map(f.users, f.orders); err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+	return f, teardown
+}
+
+// 写入 foo(20)、bar(30)、baz(30) 三个用户
+func (f *fixture) seed(t *testing.T) []*User {
+	users := []*User{{Name: "foo", Age: 20}, {Name: "bar", Age: 30}, {Name: "baz", Age: 30}}
+	for _, u := range users {
+		if err := f.users.Insert(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users
+}
+
+func TestMigrate(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+
+	pending, err := f.central.Pending(context.Background(), f.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %v", pending)
+	}
+	applied, err := f.central.Migrate(context.Background(), f.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("migrations applied twice: %v", applied)
+	}
+	var count int
+	if err := f.db.QueryRow("select count(*) from sago_migrations").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 recorded migrations, got %d", count)
+	}
+}
+
+// Pending 只是预览,不创建 sago_migrations
+func TestPendingIsReadOnly(t *testing.T) {
+	db, teardown := openSQLite(t)
+	defer teardown()
+
+	central := sago.New()
+	if err := central.ScanDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := central.Pending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 {
+		t.Errorf("expected 2 pending migrations, got %v", pending)
+	}
+	var tables int
+	if err := db.QueryRow("select count(*) from sqlite_master where type = 'table'").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("Pending created %d tables", tables)
+	}
+}
+
+func TestInsertBackfillsID(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+
+	users := f.seed(t)
+	for i, u := range users {
+		if u.ID != int64(i+1) {
+			t.Errorf("%s: expected id %d, got %d", u.Name, i+1, u.ID)
+		}
+	}
+
+	id, affected, err := f.orders.Insert(context.Background(), &Order{UserID: users[0].ID, Amount: 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || affected != 1 {
+		t.Errorf("expected (1, 1), got (%d, %d)", id, affected)
+	}
+}
+
+func TestSelectShapes(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+	f.seed(t)
+
+	foo := User{ID: 1, Name: "foo", Age: 20}
+	bar := User{ID: 2, Name: "bar", Age: 30}
+	baz := User{ID: 3, Name: "baz", Age: 30}
+
+	ptr, err := f.users.FindByID(1)
+	if err != nil || !reflect.DeepEqual(*ptr, foo) {
+		t.Errorf("FindByID: %+v %v", ptr, err)
+	}
+	if _, err := f.users.FindByID(100); err != sql.ErrNoRows {
+		t.Errorf("FindByID missing: expected sql.ErrNoRows, got %v", err)
+	}
+
+	u, ok, err := f.users.Find(2)
+	if err != nil || !ok || u != bar {
+		t.Errorf("Find: %+v %v %v", u, ok, err)
+	}
+	u, ok, err = f.users.Find(100)
+	if err != nil || ok {
+		t.Errorf("Find missing: %+v %v %v", u, ok, err)
+	}
+
+	all, err := f.users.FindAll()
+	if err != nil || !reflect.DeepEqual(all, []User{foo, bar, baz}) {
+		t.Errorf("FindAll: %+v %v", all, err)
+	}
+
+	ptrs, err := f.users.FindPtrs()
+	if err != nil || len(ptrs) != 3 || *ptrs[2] != baz {
+		t.Errorf("FindPtrs: %+v %v", ptrs, err)
+	}
+
+	count, err := f.users.Count()
+	if err != nil || count != 3 {
+		t.Errorf("Count: %d %v", count, err)
+	}
+
+	names, err := f.users.Names()
+	if err != nil || !reflect.DeepEqual(names, []string{"foo", "bar", "baz"}) {
+		t.Errorf("Names: %v %v", names, err)
+	}
+
+	row, err := f.users.Row(1)
+	expected := map[string]interface{}{"id": int64(1), "name": "foo", "age": int64(20)}
+	if err != nil || !reflect.DeepEqual(row, expected) {
+		t.Errorf("Row: %#v %v", row, err)
+	}
+
+	rows, err := f.users.Rows()
+	if err != nil || len(rows) != 3 || rows[1]["name"] != "bar" {
+		t.Errorf("Rows: %#v %v", rows, err)
+	}
+
+	table, err := f.users.Table()
+	expectedTable := [][]interface{}{
+		{"id", "name"},
+		{int64(1), "foo"},
+		{int64(2), "bar"},
+		{int64(3), "baz"},
+	}
+	if err != nil || !reflect.DeepEqual(table, expectedTable) {
+		t.Errorf("Table: %#v %v", table, err)
+	}
+
+	byID, err := f.users.ByIDs(1, 3)
+	if err != nil || !reflect.DeepEqual(byID, map[int64]User{1: foo, 3: baz}) {
+		t.Errorf("ByIDs: %+v %v", byID, err)
+	}
+
+	byAge, err := f.users.ByAge()
+	if err != nil || len(byAge) != 2 || len(byAge[20]) != 1 || len(byAge[30]) != 2 || *byAge[30][1] != baz {
+		t.Errorf("ByAge: %+v %v", byAge, err)
+	}
+}
+
+func TestDynamicSelect(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+	f.seed(t)
+
+	for _, c := range []struct {
+		name     string
+		ids      []int64
+		expected []string
+	}{
+		{"", nil, []string{"foo", "bar", "baz"}},
+		{"bar", nil, []string{"bar"}},
+		{"", []int64{1, 3}, []string{"foo", "baz"}},
+		{"foo", []int64{2, 3}, nil},
+	} {
+		users, err := f.users.Search(c.name, c.ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, u := range users {
+			names = append(names, u.Name)
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("Search(%q, %v): expected %v, got %v", c.name, c.ids, c.expected, names)
+		}
+	}
+}
+
+func TestExecuteRowCounts(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+	f.seed(t)
+
+	affected, err := f.users.Rename(1, "qux")
+	if err != nil || affected != 1 {
+		t.Errorf("Rename: %d %v", affected, err)
+	}
+	if _, err := f.users.Rename(100, "qux"); err != sago.ErrNotFound {
+		t.Errorf("Rename missing: expected ErrNotFound, got %v", err)
+	}
+
+	rs, err := f.users.SetAge(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rs.RowsAffected(); n != 3 {
+		t.Errorf("SetAge: expected 3 rows affected, got %d", n)
+	}
+
+	removed, err := f.users.Remove(2)
+	if err != nil || !removed {
+		t.Errorf("Remove: %v %v", removed, err)
+	}
+	removed, err = f.users.Remove(2)
+	if err != nil || removed {
+		t.Errorf("Remove twice: %v %v", removed, err)
+	}
+
+	all, err := f.users.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []User{{ID: 1, Name: "qux", Age: 40}, {ID: 3, Name: "baz", Age: 40}}
+	if !reflect.DeepEqual(all, expected) {
+		t.Errorf("expected %+v, got %+v", expected, all)
+	}
+}
+
+func TestCache(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+	f.seed(t)
+
+	first, err := f.users.Cache.FindByID(1)
+	if err != nil || first.Name != "foo" {
+		t.Fatalf("Cache.FindByID: %+v %v", first, err)
+	}
+	// 修改缓存返回的值不影响缓存
+	first.Name = "changed"
+	if _, err := f.users.Rename(1, "qux"); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := f.users.Cache.FindByID(1)
+	if err != nil || cached.Name != "foo" {
+		t.Errorf("expected cached foo, got %+v %v", cached, err)
+	}
+	if f.cache.hits != 1 {
+		t.Errorf("expected 1 cache hit, got %d", f.cache.hits)
+	}
+	fresh, err := f.users.FindByID(1)
+	if err != nil || fresh.Name != "qux" {
+		t.Errorf("expected qux from the database, got %+v %v", fresh, err)
+	}
+
+	// 未查到的结果不缓存,再次查询仍为 exist=false
+	for i := 0; i < 2; i++ {
+		u, ok, err := f.users.Cache.Find(100)
+		if err != nil || ok {
+			t.Errorf("Cache.Find missing: %+v %v %v", u, ok, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		u, ok, err := f.users.Cache.Find(2)
+		if err != nil || !ok || u.Name != "bar" {
+			t.Errorf("Cache.Find(2): %+v %v %v", u, ok, err)
+		}
+	}
+	if f.cache.hits != 2 {
+		t.Errorf("expected 2 cache hits, got %d", f.cache.hits)
+	}
+}
+
+func TestYAMLDao(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+	users := f.seed(t)
+
+	ctx := context.Background()
+	for _, o := range []*Order{
+		{UserID: users[0].ID, Amount: 1.5},
+		{UserID: users[0].ID, Amount: 2.5},
+		{UserID: users[1].ID, Amount: 4},
+	} {
+		if _, _, err := f.orders.Insert(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byUser, err := f.orders.ByUser(ctx, []int64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byUser) != 2 || len(byUser[1]) != 2 || byUser[2][0].Amount != 4 {
+		t.Errorf("ByUser: %+v", byUser)
+	}
+
+	total, err := f.orders.Total(1)
+	if err != nil || total != 4 {
+		t.Errorf("Total: %v %v", total, err)
+	}
+
+	list, err := f.orders.UsersWithOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected 3 users, got %d", len(list))
+	}
+	if len(list[0].Orders) != 2 || list[0].Orders[1].Amount != 2.5 || len(list[1].Orders) != 1 || len(list[2].Orders) != 0 {
+		t.Errorf("UsersWithOrders: %+v %+v %+v", list[0], list[1], list[2])
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+
+	issues, err := f.central.VerifySchema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("expected no drift, got %v", issues)
+	}
+
+	// age 被删除,新增的 email 没有默认值
+	for _, stmt := range []string{
+		"drop table user",
+		"create table user (id integer primary key autoincrement, name text not null, email text not null)",
+	} {
+		if _, err := f.db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issues, err = f.central.VerifySchema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problems []string
+	for _, issue := range issues {
+		problems = append(problems, issue.Column+": "+issue.Problem)
+	}
+	expected := []string{"age: no such column", "email: NOT NULL column without default is not inserted"}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, issues)
+	}
+}
+
+func TestDriverErrors(t *testing.T) {
+	f, teardown := setup(t)
+	defer teardown()
+
+	if _, err := f.db.Exec("drop table user"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := f.users.FindAll()
+	if err == nil || !strings.Contains(err.Error(), "no such table") {
+		t.Errorf("expected no such table, got %v", err)
+	}
+}
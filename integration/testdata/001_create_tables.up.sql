@@ -0,0 +1,10 @@
+create table user (
+    id integer primary key autoincrement,
+    name text not null,
+    age integer not null default 0
+);
+create table orders (
+    id integer primary key autoincrement,
+    user_id integer not null,
+    amount real not null default 0
+);
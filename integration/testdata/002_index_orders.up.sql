@@ -0,0 +1 @@
+create index idx_orders_user_id on orders (user_id);
@@ -0,0 +1,319 @@
+package sago
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 迁移
+// 文件中的 <migration version="20240101_01" name="create_user">create table ...</migration>
+// 或 ScanDir 目录下的 NNN_name.up.sql 文件
+type MigrationContent struct {
+	Version string `xml:"version,attr" yaml:"version"`
+	Name    string `xml:"name,attr" yaml:"name"`
+	SQL     string `xml:",chardata" yaml:"sql"`
+}
+
+type Migration struct {
+	Version string
+	Name    string
+	SQL     string
+}
+
+// 迁移 SQL 的 sha256,已执行的迁移被修改时 Migrate 报错
+func (mg Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(mg.SQL)))
+	return hex.EncodeToString(sum[:])
+}
+
+const migrationsTable = "sago_migrations"
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.up\.sql$`)
+
+func parseMigrationFile(path, name string) (*Migration, error) {
+	match := migrationFilePattern.FindStringSubmatch(name)
+	if match == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Migration{Version: match[1], Name: match[2], SQL: string(data)}, nil
+}
+
+// 全部迁移,按版本排序,版本中的数字按数值比较
+func (m *Central) Migrations() ([]Migration, error) {
+	migrations := append([]Migration{}, m.migrations...)
+	for _, f := range m.files {
+		for _, content := range f.Migrations {
+			migrations = append(migrations, Migration{Version: content.Version, Name: content.Name, SQL: content.SQL})
+		}
+	}
+	versions := map[string]bool{}
+	for _, mg := range migrations {
+		if mg.Version == "" {
+			return nil, fmt.Errorf("sago: migration %q has no version", mg.Name)
+		}
+		if versions[mg.Version] {
+			return nil, fmt.Errorf("sago: duplicate migration version %s", mg.Version)
+		}
+		versions[mg.Version] = true
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareVersions(migrations[i].Version, migrations[j].Version) < 0
+	})
+	return migrations, nil
+}
+
+var versionPartPattern = regexp.MustCompile(`\d+|\D+`)
+
+func compareVersions(a, b string) int {
+	pa, pb := versionPartPattern.FindAllString(a, -1), versionPartPattern.FindAllString(b, -1)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, y := pa[i], pb[i]
+		if isDigits(x) && isDigits(y) {
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				if len(x) < len(y) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+func isDigits(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// Postgres 使用 $n 占位符
+func migrationPlaceholders(db *sql.DB, n int) []string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		if DialectOf(db) == Postgres {
+			placeholders[i] = fmt.Sprint("$", i+1)
+		} else {
+			placeholders[i] = "?"
+		}
+	}
+	return placeholders
+}
+
+func ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "create table if not exists "+migrationsTable+" ("+
+		"version varchar(255) not null primary key, "+
+		"name varchar(255) not null, "+
+		"checksum varchar(64) not null, "+
+		"applied_at timestamp not null default current_timestamp)")
+	return err
+}
+
+// 只读地检查 sago_migrations 是否存在
+// 无法识别方言时以查询该表是否出错判断
+func migrationsTableExists(ctx context.Context, db *sql.DB) (bool, error) {
+	var query string
+	switch DialectOf(db) {
+	case MySQL:
+		query = "select count(*) from information_schema.tables where table_schema = database() and table_name = ?"
+	case Postgres:
+		query = "select count(*) from information_schema.tables where table_schema = current_schema() and table_name = $1"
+	case SQLite:
+		query = "select count(*) from sqlite_master where type = 'table' and name = ?"
+	default:
+		rows, err := db.QueryContext(ctx, "select version from "+migrationsTable+" where 1 = 0")
+		if err != nil {
+			return false, nil
+		}
+		return true, rows.Close()
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, query, migrationsTable).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// 已执行的版本及其 checksum
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "select version, checksum from "+migrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[string]string{}
+	for rows.Next() {
+		var version, checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = checksum
+	}
+	return applied, rows.Err()
+}
+
+// 尚未在 db 上执行的迁移,不写入数据库,可用于预览
+// sago_migrations 不存在时视为没有执行过任何迁移,已执行的迁移内容被修改时返回错误
+func (m *Central) Pending(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	exists, err := migrationsTableExists(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]string{}
+	if exists {
+		if applied, err = appliedMigrations(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+	return pendingMigrations(migrations, applied)
+}
+
+func pendingMigrations(migrations []Migration, applied map[string]string) ([]Migration, error) {
+	var pending []Migration
+	for _, mg := range migrations {
+		checksum, ok := applied[mg.Version]
+		if !ok {
+			pending = append(pending, mg)
+		} else if checksum != mg.Checksum() {
+			return nil, fmt.Errorf("sago: migration %s_%s was changed after it was applied", mg.Version, mg.Name)
+		}
+	}
+	return pending, nil
+}
+
+// 按版本顺序执行尚未执行的迁移,每个迁移在一个事务中执行并记录到 sago_migrations
+// 返回本次执行的迁移;MySQL 的 DDL 会隐式提交,失败时不能回滚
+func (m *Central) Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return nil, err
+	}
+	placeholders := migrationPlaceholders(db, 3)
+	record := "insert into " + migrationsTable + " (version, name, checksum) values (" + strings.Join(placeholders, ", ") + ")"
+	for i, mg := range pending {
+		if err := applyMigration(ctx, db, mg, record); err != nil {
+			return pending[:i], fmt.Errorf("sago: migration %s_%s: %v", mg.Version, mg.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, mg Migration, record string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range splitStatements(mg.SQL) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, mg.Version, mg.Name, mg.Checksum()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 按 ; 拆分语句,忽略引号、-- 与 /* */ 注释以及 Postgres $$ 字符串中的 ;
+// 不支持语句内含有 ; 的 MySQL 存储过程与触发器(需要 DELIMITER)
+func splitStatements(sqlText string) []string {
+	var statements []string
+	var b strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			statements = append(statements, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(sqlText); i++ {
+		c := sqlText[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(sqlText) && sqlText[end] != c {
+				if sqlText[end] == '\\' && c == '\'' {
+					end++
+				}
+				end++
+			}
+			if end >= len(sqlText) {
+				end = len(sqlText) - 1
+			}
+			b.WriteString(sqlText[i : end+1])
+			i = end
+		case c == '-' && i+1 < len(sqlText) && sqlText[i+1] == '-':
+			for i < len(sqlText) && sqlText[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == '/' && i+1 < len(sqlText) && sqlText[i+1] == '*':
+			end := strings.Index(sqlText[i+2:], "*/")
+			if end < 0 {
+				i = len(sqlText)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c == '$' && dollarTag(sqlText[i:]) != "":
+			tag := dollarTag(sqlText[i:])
+			end := strings.Index(sqlText[i+len(tag):], tag)
+			if end < 0 {
+				end = len(sqlText)
+			} else {
+				end = i + len(tag) + end + len(tag)
+			}
+			b.WriteString(sqlText[i:end])
+			i = end - 1
+		case c == ';':
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// Postgres 的 $$ 或 $tag$ 开头,$1 等占位符不是
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 1 && '0' <= c && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package sago
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanMigrations(t *testing.T) {
+	dir := filepath.Dir(writeTempFile(t, "user.sql.xml", `<sago>
+	<type>UserDao</type>
+	<migration version="20240101_01" name="add_email">alter table user add email varchar(64)</migration>
+</sago>`))
+	for name, content := range map[string]string{
+		"002_create_orders.up.sql": "create table orders (id integer)",
+		"001_create_user.up.sql":   "create table user (id integer)",
+		"001_create_user.down.sql": "drop table user",
+		"20240102_seed.up.sql":     "insert into user (id) values (1)",
+		"notes.sql":                "select 1",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := New()
+	if err := m.ScanDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := m.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, mg := range migrations {
+		versions = append(versions, mg.Version+"_"+mg.Name)
+	}
+	expected := []string{"001_create_user", "002_create_orders", "20240101_01_add_email", "20240102_seed"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("got %v", versions)
+	}
+
+	m.migrations = append(m.migrations, Migration{Version: "001", Name: "again"})
+	if _, err := m.Migrations(); err == nil {
+		t.Error("expected error for duplicate version")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		less bool
+	}{
+		{"001", "002", true},
+		{"9", "10", true},
+		{"20240101_01", "20240101_02", true},
+		{"20240101_10", "20240101_9", false},
+		{"1", "1_1", true},
+	}
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.b) < 0; got != c.less {
+			t.Errorf("%s < %s = %v", c.a, c.b, got)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements(`
+create table a (id int); -- first; table
+insert into a values ('x;y', "z;");
+insert into a values ('it\'s; fine')
+`)
+	expected := []string{
+		"create table a (id int)",
+		`insert into a values ('x;y', "z;")`,
+		`insert into a values ('it\'s; fine')`,
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("got %q", statements)
+	}
+
+	statements = splitStatements(`
+/* drop; recreate */ create table b (id int);
+create function f() returns int as $$ begin return 1; end; $$ language plpgsql;
+create function g() returns int as $body$ select 1; $body$ language sql;
+update b set id = $1 where id = $2
+`)
+	expected = []string{
+		"create table b (id int)",
+		"create function f() returns int as $$ begin return 1; end; $$ language plpgsql",
+		"create function g() returns int as $body$ select 1; $body$ language sql",
+		"update b set id = $1 where id = $2",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("got %q", statements)
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	a := Migration{SQL: "create table a (id int)\n"}
+	b := Migration{SQL: "  create table a (id int)"}
+	if a.Checksum() != b.Checksum() || len(a.Checksum()) != 64 {
+		t.Error("checksum should ignore surrounding whitespace")
+	}
+	if a.Checksum() == (Migration{SQL: "create table b (id int)"}).Checksum() {
+		t.Error("checksum should change with the sql")
+	}
+}
@@ -0,0 +1,63 @@
+package sago
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Map 过的 DAO 中生成的函数名,按名称排序
+func (m *Central) MappedFuncs(dao interface{}) []string {
+	name := m.daoName(dao)
+	var names []string
+	for _, s := range m.statements {
+		if s.dao == name {
+			names = append(names, s.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 按调用 dao 的函数 fn 时的方式渲染 SQL,不访问数据库,用于测试与调试
+// args 不包括 context.Context,不传 args 时以参数的零值渲染,指针参数指向零值
+func (m *Central) Render(dao interface{}, fn string, args ...interface{}) (sql string, sqlArgs []interface{}, err error) {
+	name := m.daoName(dao)
+	i, ok := m.statementKeys[statementKey{name, fn}]
+	if !ok {
+		return "", nil, fmt.Errorf("sago: %s.%s is not mapped", name, fn)
+	}
+	statement := m.statements[i]
+	values := zeroArgs(statement.argTypes)
+	if len(args) > 0 {
+		if len(args) != len(values) {
+			return "", nil, fmt.Errorf("sago: %s.%s takes %d args, got %d", name, fn, len(values), len(args))
+		}
+		for i, arg := range args {
+			if arg == nil {
+				values[i] = reflect.Zero(statement.argTypes[i])
+				continue
+			}
+			value := reflect.ValueOf(arg)
+			if !isKeyConvertible(value.Type(), statement.argTypes[i]) {
+				return "", nil, fmt.Errorf("sago: %s.%s arg %d: %s is not %s", name, fn, i, value.Type(), statement.argTypes[i])
+			}
+			value = value.Convert(statement.argTypes[i])
+			values[i] = value
+		}
+	}
+	e := statement.executor
+	return e.renderTpl(values, e.Table)
+}
+
+func (m *Central) daoName(dao interface{}) string {
+	typ := reflect.TypeOf(dao)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil {
+		return ""
+	}
+	_, name := m.getSQLSet(typ)
+	return name
+}
@@ -0,0 +1,64 @@
+package sago
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+type renderUser struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type renderDao struct {
+	DB        *sql.DB
+	FindByIDs func(ids ...int64) ([]renderUser, error)
+	Insert    func(u *renderUser) error
+}
+
+func TestRender(t *testing.T) {
+	m := newTestCentral(&File{Type: "renderDao", Table: "user",
+		Selects: []SQLContent{{Name: "FindByIDs", Args: "ids", SQL: "select {{.fields}} from {{.table}} where `id` {{in .ids}}"}},
+		Inserts: []SQLContent{{Name: "Insert", Args: "u", SQL: "insert into {{.table}} (`name`) values ({{arg .u.Name}})"}},
+	})
+	dao := &renderDao{DB: &sql.DB{}}
+	if err := m.Map(dao); err != nil {
+		t.Fatal(err)
+	}
+	if names := m.MappedFuncs(dao); !reflect.DeepEqual(names, []string{"FindByIDs", "Insert"}) {
+		t.Errorf("mapped funcs %v", names)
+	}
+
+	sqlText, sqlArgs, err := m.Render(dao, "FindByIDs", []int{1, 2})
+	if err == nil {
+		t.Errorf("[]int is not []int64: %s", sqlText)
+	}
+	sqlText, sqlArgs, err = m.Render(dao, "FindByIDs", []int64{1, 2})
+	if err != nil || sqlText != "select `id`,`name` from user where `id` in (?,?)" || len(sqlArgs) != 2 {
+		t.Error(sqlText, sqlArgs, err)
+	}
+	sqlText, sqlArgs, err = m.Render(dao, "Insert")
+	if err != nil || sqlText != "insert into user (`name`) values (?)" || sqlArgs[0] != "" {
+		t.Error(sqlText, sqlArgs, err)
+	}
+	if _, _, err := m.Render(dao, "Missing"); err == nil {
+		t.Error("expected error for unmapped func")
+	}
+	if _, _, err := m.Render(dao, "Insert", 1); err == nil {
+		t.Error("expected error for wrong arg type")
+	}
+
+	// 再次 Map 替换之前的语句,不会累积
+	m.fullNameMap["renderDao"].Functions["Insert"].SQL = "insert into {{.table}} (`id`, `name`) values ({{arg .u.ID}}, {{arg .u.Name}})"
+	if err := m.Map(dao); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.statements) != 2 {
+		t.Errorf("expected 2 statements after Map again, got %d", len(m.statements))
+	}
+	sqlText, _, err = m.Render(dao, "Insert")
+	if err != nil || sqlText != "insert into user (`id`, `name`) values (?, ?)" {
+		t.Error(sqlText, err)
+	}
+}
@@ -0,0 +1,88 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// DAO 声明 ReadDB *sql.DB 或 ReadDBs []*sql.DB 字段时,select 在从库上执行
+// insert/execute/update/delete 始终使用 DB
+// Balancer 从多个从库中选择一个,done 在语句执行完成后调用
+type Balancer interface {
+	Pick(replicas []*sql.DB) (i int, done func())
+}
+
+func noop() {}
+
+type roundRobin struct {
+	next uint64
+}
+
+// 轮询
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Pick(replicas []*sql.DB) (int, func()) {
+	n := atomic.AddUint64(&b.next, 1)
+	return int((n - 1) % uint64(len(replicas))), noop
+}
+
+type random struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// 随机
+func Random() Balancer {
+	return &random{rand: rand.New(rand.NewSource(rand.Int63()))}
+}
+
+func (b *random) Pick(replicas []*sql.DB) (int, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rand.Intn(len(replicas)), noop
+}
+
+type leastInFlight struct {
+	inFlight sync.Map // *sql.DB -> *int64
+}
+
+// 选择执行中语句最少的从库
+func LeastInFlight() Balancer {
+	return &leastInFlight{}
+}
+
+func (b *leastInFlight) counter(db *sql.DB) *int64 {
+	counter, _ := b.inFlight.LoadOrStore(db, new(int64))
+	return counter.(*int64)
+}
+
+func (b *leastInFlight) Pick(replicas []*sql.DB) (int, func()) {
+	picked, least := 0, int64(-1)
+	for i, db := range replicas {
+		if n := atomic.LoadInt64(b.counter(db)); least < 0 || n < least {
+			picked, least = i, n
+		}
+	}
+	counter := b.counter(replicas[picked])
+	atomic.AddInt64(counter, 1)
+	return picked, func() {
+		atomic.AddInt64(counter, -1)
+	}
+}
+
+type primaryKey struct{}
+
+// 返回的 ctx 传给 DAO 函数时,select 也在主库执行,用于写后立即读
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
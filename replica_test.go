@@ -0,0 +1,116 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestBalancers(t *testing.T) {
+	replicas := []*sql.DB{{}, {}, {}}
+
+	rr := RoundRobin()
+	for i := 0; i < 6; i++ {
+		if picked, _ := rr.Pick(replicas); picked != i%3 {
+			t.Errorf("round robin pick %d = %d", i, picked)
+		}
+	}
+
+	random := Random()
+	for i := 0; i < 20; i++ {
+		if picked, _ := random.Pick(replicas); picked < 0 || picked >= 3 {
+			t.Errorf("random pick out of range: %d", picked)
+		}
+	}
+
+	least := LeastInFlight()
+	first, doneFirst := least.Pick(replicas)
+	second, doneSecond := least.Pick(replicas)
+	if first == second {
+		t.Errorf("least in flight picked busy replica %d twice", first)
+	}
+	doneFirst()
+	if picked, done := least.Pick(replicas); picked != first {
+		t.Errorf("least in flight = %d, want released %d", picked, first)
+	} else {
+		done()
+	}
+	doneSecond()
+}
+
+type replicaDao struct {
+	DB      *sql.DB
+	ReadDB  *sql.DB
+	ReadDBs []*sql.DB
+	Find    func(ctx context.Context, id int64) (int64, error)
+	Save    func(ctx context.Context, id int64) error
+	Cache   *replicaDao
+}
+
+type replicaRepo struct {
+	DB     *sql.DB
+	ReadDB *sql.DB
+	Users  struct {
+		Find func(id int64) (int64, error)
+	}
+}
+
+func TestResolveReplicas(t *testing.T) {
+	primary, r1, r2, r3 := &sql.DB{}, &sql.DB{}, &sql.DB{}, &sql.DB{}
+	dao := &replicaDao{DB: primary, ReadDB: r1, ReadDBs: []*sql.DB{r2, nil, r3}}
+	dbs, _, err := resolveDBs(reflect.ValueOf(dao).Elem(), daoDBs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbs.primary != primary || len(dbs.replicas) != 3 || dbs.replicas[0] != r1 || dbs.replicas[2] != r3 {
+		t.Errorf("unexpected dbs %+v", dbs)
+	}
+
+	repo := &replicaRepo{ReadDB: r1}
+	dbs, _, _ = resolveDBs(reflect.ValueOf(&repo.Users).Elem(), daoDBs{primary: primary, replicas: []*sql.DB{r1}})
+	if dbs.primary != primary || len(dbs.replicas) != 1 {
+		t.Errorf("nested struct should inherit replicas: %+v", dbs)
+	}
+
+	type wrongDao struct {
+		DB     *sql.DB
+		ReadDB sql.DB
+	}
+	if _, _, err := resolveDBs(reflect.ValueOf(&wrongDao{}).Elem(), daoDBs{}); err == nil {
+		t.Error("expected error for ReadDB with wrong type")
+	}
+}
+
+func TestReader(t *testing.T) {
+	primary, replica := &sql.DB{}, &sql.DB{}
+	e := NewSQLExecutor("t", "dao", []reflect.Type{reflect.TypeOf(int64(0)), emptyErrorType}, &Fn{}, nil, primary, nil)
+	if db, _ := e.reader(context.Background()); db != e.DB {
+		t.Error("without replicas select should use DB")
+	}
+	e.setReplicas([]*sql.DB{replica}, RoundRobin())
+	if db, _ := e.reader(context.Background()); db.DB != replica {
+		t.Error("select should use the replica")
+	}
+	if db, _ := e.reader(WithPrimary(context.Background())); db != e.DB {
+		t.Error("WithPrimary should force DB")
+	}
+}
+
+func TestContextArg(t *testing.T) {
+	m := newTestCentral(&File{Type: "replicaDao", Table: "t",
+		Selects:  []SQLContent{{Name: "Find", Args: "id:int64", SQL: "select id from {{.table}} where id = {{arg .id}}"}},
+		Executes: []SQLContent{{Name: "Save", Args: "id", SQL: "update {{.table}} set id = {{arg .id}}"}},
+	})
+	cache := mapCache{}
+	m.Cache = cache
+	dao := &replicaDao{DB: &sql.DB{}, ReadDB: &sql.DB{}}
+	if err := m.Map(dao); err != nil {
+		t.Fatal(err)
+	}
+	// context.Context 不计入缓存 key
+	cache["replicaDao.Find[7]"] = int64(7)
+	if id, err := dao.Cache.Find(context.Background(), 7); err != nil || id != 7 {
+		t.Error(id, err)
+	}
+}
@@ -0,0 +1,131 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 重试策略
+// 语句的 retry/backoff 属性覆盖 Central.Retry,写语句只有声明 idempotent="true" 时重试
+type RetryPolicy struct {
+	// 失败后重试的次数
+	Retries int
+	// 第一次重试前等待的时间,之后每次翻倍
+	Backoff time.Duration
+}
+
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// 根据驱动的类型判断数据库方言,无法判断时返回空字符串
+func DialectOf(db *sql.DB) Dialect {
+	name := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(name, "mysql"):
+		return MySQL
+	case strings.Contains(name, "pq."), strings.Contains(name, "pgx"), strings.Contains(name, "postgres"):
+		return Postgres
+	case strings.Contains(name, "sqlite"):
+		return SQLite
+	}
+	return ""
+}
+
+// 判断错误是否为可以重试的临时错误
+type ErrorClassifier func(err error) bool
+
+// 默认的分类,可以通过 Central.Classifiers 替换
+func defaultClassifiers() map[Dialect]ErrorClassifier {
+	return map[Dialect]ErrorClassifier{
+		MySQL:    isMySQLTransient,
+		Postgres: isSQLStateTransient,
+		SQLite:   isSQLiteTransient,
+	}
+}
+
+// 1213 死锁,1205 锁等待超时
+func isMySQLTransient(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if number, ok := mysqlErrorNumber(err); ok {
+			return number == 1213 || number == 1205
+		}
+	}
+	return false
+}
+
+// 以反射读取 *mysql.MySQLError 的 Number,避免 core 引入并注册 MySQL 驱动
+func mysqlErrorNumber(err error) (uint64, bool) {
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return 0, false
+	}
+	typ := v.Type().Elem()
+	if typ.Kind() != reflect.Struct || typ.Name() != "MySQLError" || !strings.HasSuffix(typ.PkgPath(), "go-sql-driver/mysql") {
+		return 0, false
+	}
+	number := v.Elem().FieldByName("Number")
+	switch number.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return number.Uint(), true
+	}
+	return 0, false
+}
+
+// 40001 serialization_failure,40P01 deadlock_detected
+func isSQLStateTransient(err error) bool {
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		state := stateErr.SQLState()
+		return state == "40001" || state == "40P01"
+	}
+	return false
+}
+
+func isSQLiteTransient(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked")
+}
+
+func (e *SQLExecutor) isTransient(db *sqlx.DB, err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	if classify := e.classifiers[DialectOf(db.DB)]; classify != nil {
+		return classify(err)
+	}
+	return false
+}
+
+// 执行 run,遇到临时错误时按策略等待后重试,等待期间 ctx 结束则返回 ctx 的错误
+func (e *SQLExecutor) withRetry(ctx context.Context, db *sqlx.DB, write bool, run func() error) error {
+	retries := e.retry.Retries
+	if write && !e.Fn.Idempotent {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= retries || !e.isTransient(db, err) {
+			return err
+		}
+		timer := time.NewTimer(e.retry.Backoff << uint(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pq: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+// 与驱动的错误同名但不属于驱动
+type MySQLError struct{ Number uint16 }
+
+func (e *MySQLError) Error() string { return "not a driver error" }
+
+func TestClassifiers(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	cases := []struct {
+		classify ErrorClassifier
+		err      error
+		expected bool
+	}{
+		{isMySQLTransient, deadlock, true},
+		{isMySQLTransient, fmt.Errorf("insert: %w", deadlock), true},
+		{isMySQLTransient, &mysql.MySQLError{Number: 1205}, true},
+		{isMySQLTransient, &mysql.MySQLError{Number: 1062}, false},
+		{isMySQLTransient, &MySQLError{Number: 1213}, false},
+		{isMySQLTransient, errors.New("Error 1213: Deadlock found"), false},
+		{isSQLStateTransient, sqlStateError("40001"), true},
+		{isSQLStateTransient, sqlStateError("40P01"), true},
+		{isSQLStateTransient, sqlStateError("23505"), false},
+		{isSQLiteTransient, errors.New("database is locked"), true},
+		{isSQLiteTransient, errors.New("UNIQUE constraint failed"), false},
+	}
+	for _, c := range cases {
+		if got := c.classify(c.err); got != c.expected {
+			t.Errorf("%v: got %v, expected %v", c.err, got, c.expected)
+		}
+	}
+}
+
+func TestDialectOf(t *testing.T) {
+	db, err := sql.Open("mysql", "user@/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if dialect := DialectOf(db); dialect != MySQL {
+		t.Errorf("dialect = %q", dialect)
+	}
+}
+
+func newRetryExecutor(t *testing.T, fn Fn) (*SQLExecutor, *sqlx.DB) {
+	db, err := sql.Open("mysql", "user@/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &SQLExecutor{Fn: fn, retry: RetryPolicy{Retries: 2, Backoff: time.Millisecond}, classifiers: defaultClassifiers()}
+	return e, sqlx.NewDb(db, "mysql")
+}
+
+func TestWithRetry(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213}
+	failing := func(attempts *int, failures int, err error) func() error {
+		return func() error {
+			*attempts++
+			if *attempts <= failures {
+				return err
+			}
+			return nil
+		}
+	}
+	e, db := newRetryExecutor(t, Fn{Type: "select"})
+
+	attempts := 0
+	if err := e.withRetry(context.Background(), db, false, failing(&attempts, 2, deadlock)); err != nil || attempts != 3 {
+		t.Errorf("select: attempts %d, err %v", attempts, err)
+	}
+	attempts = 0
+	if err := e.withRetry(context.Background(), db, false, failing(&attempts, 5, driver.ErrBadConn)); err != driver.ErrBadConn || attempts != 3 {
+		t.Errorf("exhausted: attempts %d, err %v", attempts, err)
+	}
+	attempts = 0
+	if err := e.withRetry(context.Background(), db, false, failing(&attempts, 5, sql.ErrNoRows)); err != sql.ErrNoRows || attempts != 1 {
+		t.Errorf("permanent error retried: attempts %d", attempts)
+	}
+	attempts = 0
+	if err := e.withRetry(context.Background(), db, true, failing(&attempts, 1, deadlock)); err != deadlock || attempts != 1 {
+		t.Errorf("non idempotent write retried: attempts %d", attempts)
+	}
+	e.Fn.Idempotent = true
+	attempts = 0
+	if err := e.withRetry(context.Background(), db, true, failing(&attempts, 1, deadlock)); err != nil || attempts != 2 {
+		t.Errorf("idempotent write: attempts %d, err %v", attempts, err)
+	}
+
+	e.retry.Backoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	if err := e.withRetry(ctx, db, false, failing(&attempts, 1, deadlock)); err != context.Canceled {
+		t.Errorf("backoff should stop on ctx: %v", err)
+	}
+}
+
+func TestRetryCheckedAtMap(t *testing.T) {
+	type retryDao struct {
+		DB   *sql.DB
+		Save func(id int64) error
+	}
+	save := SQLContent{Name: "Save", Args: "id", Retry: 3, SQL: "update t set a = 1 where id = {{arg .id}}"}
+	if err := newTestCentral(&File{Type: "retryDao", Executes: []SQLContent{save}}).Map(&retryDao{DB: &sql.DB{}}); err == nil {
+		t.Error("expected error for retry without idempotent")
+	}
+	save.Idempotent = true
+	if err := newTestCentral(&File{Type: "retryDao", Executes: []SQLContent{save}}).Map(&retryDao{DB: &sql.DB{}}); err != nil {
+		t.Error(err)
+	}
+	save.Backoff = "soon"
+	if err := newTestCentral(&File{Type: "retryDao", Executes: []SQLContent{save}}).Map(&retryDao{DB: &sql.DB{}}); err == nil {
+		t.Error("expected error for bad backoff")
+	}
+}
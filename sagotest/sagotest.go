@@ -0,0 +1,224 @@
+// sagotest 提供一个进程内的 database/sql 驱动,用于不依赖数据库测试 DAO
+//
+//	db, mock := sagotest.New()
+//	dao := &UserDao{DB: db}
+//	s.Map(dao)
+//	mock.ExpectQuery("select `id`,`name` from user where `id` in (?...)").
+//		WithArgs(1, 2).
+//		WillReturnRows(sagotest.NewRows("id", "name").AddRow(1, "foo"))
+//	users, err := dao.FindByIDs([]int64{1, 2})
+//	if err := mock.ExpectationsWereMet(); err != nil {
+//		t.Error(err)
+//	}
+//
+// 期望的 SQL 忽略大小写和空白的差异,{{arg}} 渲染为 ?,{{in}} 渲染的 in (?,?,?) 可以写作 (?...) 匹配任意个数
+package sagotest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 匹配任意参数
+type anyArg struct{}
+
+func AnyArg() interface{} {
+	return anyArg{}
+}
+
+type Rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// 值按 database/sql 的默认规则转换,例如 int 转为 int64
+func (r *Rows) AddRow(values ...interface{}) *Rows {
+	if len(values) != len(r.columns) {
+		panic(fmt.Sprintf("sagotest: row has %d values, expected %d", len(values), len(r.columns)))
+	}
+	row := make([]driver.Value, len(values))
+	for i, v := range values {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(v)
+		if err != nil {
+			panic("sagotest: " + err.Error())
+		}
+		row[i] = converted
+	}
+	r.values = append(r.values, row)
+	return r
+}
+
+type Expectation struct {
+	query   bool
+	sql     string
+	pattern *regexp.Regexp
+	args    []interface{}
+	hasArgs bool
+	rows    *Rows
+	result  driver.Result
+	err     error
+	met     bool
+}
+
+// 期望的参数,不调用时不检查参数
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	e.args = args
+	e.hasArgs = true
+	return e
+}
+
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	return e
+}
+
+func (e *Expectation) WillReturnResult(lastInsertID, rowsAffected int64) *Expectation {
+	e.result = result{lastInsertID, rowsAffected}
+	return e
+}
+
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) String() string {
+	kind := "exec"
+	if e.query {
+		kind = "query"
+	}
+	if e.hasArgs {
+		return fmt.Sprintf("%s %q with args %v", kind, e.sql, e.args)
+	}
+	return fmt.Sprintf("%s %q", kind, e.sql)
+}
+
+type result struct {
+	lastInsertID, rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r result) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// 按顺序记录期望,驱动收到的每条语句必须与下一个未满足的期望一致
+type Mock struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// 返回连接到新 Mock 的 *sql.DB
+func New() (*sql.DB, *Mock) {
+	mock := &Mock{}
+	return sql.OpenDB(connector{mock}), mock
+}
+
+func (m *Mock) expect(query bool, sqlText string) *Expectation {
+	e := &Expectation{query: query, sql: sqlText, pattern: compilePattern(sqlText)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// select 等返回行的语句
+func (m *Mock) ExpectQuery(sqlText string) *Expectation {
+	return m.expect(true, sqlText)
+}
+
+// insert/update/delete 等语句
+func (m *Mock) ExpectExec(sqlText string) *Expectation {
+	return m.expect(false, sqlText)
+}
+
+// 所有期望都已满足且没有意外的语句时返回 nil
+func (m *Mock) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var problems []string
+	problems = append(problems, m.unexpected...)
+	for _, e := range m.expectations {
+		if !e.met {
+			problems = append(problems, "not called: "+e.String())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("sagotest: " + strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+var spacePattern = regexp.MustCompile(`\s+`)
+
+func normalize(sqlText string) string {
+	return strings.TrimSpace(spacePattern.ReplaceAllString(sqlText, " "))
+}
+
+func compilePattern(sqlText string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(normalize(sqlText))
+	quoted = strings.Replace(quoted, regexp.QuoteMeta("(?...)"), `\(\s*\?(?:\s*,\s*\?)*\s*\)`, -1)
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+// 取出与 sqlText 匹配的下一个期望
+func (m *Mock) match(query bool, sqlText string, args []driver.NamedValue) (*Expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *Expectation
+	for _, e := range m.expectations {
+		if !e.met {
+			next = e
+			break
+		}
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	call := fmt.Sprintf("%q with args %v", normalize(sqlText), values)
+	if next == nil {
+		m.unexpected = append(m.unexpected, "unexpected: "+call)
+		return nil, errors.New("sagotest: unexpected " + call)
+	}
+	if next.query != query || !next.pattern.MatchString(normalize(sqlText)) {
+		m.unexpected = append(m.unexpected, "unexpected: "+call+", expected "+next.String())
+		return nil, fmt.Errorf("sagotest: %s does not match %s", call, next)
+	}
+	if next.hasArgs {
+		if err := matchArgs(next.args, args); err != nil {
+			m.unexpected = append(m.unexpected, "unexpected: "+call+": "+err.Error())
+			return nil, fmt.Errorf("sagotest: %s: %v", call, err)
+		}
+	}
+	next.met = true
+	return next, nil
+}
+
+func matchArgs(expected []interface{}, args []driver.NamedValue) error {
+	if len(expected) != len(args) {
+		return fmt.Errorf("expected %d args, got %d", len(expected), len(args))
+	}
+	for i, e := range expected {
+		if _, ok := e.(anyArg); ok {
+			continue
+		}
+		converted, err := driver.DefaultParameterConverter.ConvertValue(e)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(converted, args[i].Value) {
+			return fmt.Errorf("arg %d: expected %v, got %v", i, e, args[i].Value)
+		}
+	}
+	return nil
+}
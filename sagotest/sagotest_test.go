@@ -0,0 +1,133 @@
+package sagotest_test
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mengxiaozhu/sago"
+	"github.com/mengxiaozhu/sago/sagotest"
+)
+
+type User struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type UserDao struct {
+	DB        *sql.DB
+	FindByIDs func(ids []int64) ([]User, error)
+	Find      func(id int64) (*User, bool, error)
+	Insert    func(u *User) (int64, error)
+	Rename    func(id int64, name string) error
+}
+
+const userXML = `<sago>
+	<type>UserDao</type>
+	<table>user</table>
+	<select name="FindByIDs" args="ids">select {{.fields}} from {{.table}} where ` + "`id`" + ` {{in .ids}}</select>
+	<select name="Find" args="id">select {{.fields}} from {{.table}} where ` + "`id`" + ` = {{arg .id}}</select>
+	<insert name="Insert" args="u">insert into {{.table}} (` + "`name`" + `) values ({{arg .u.Name}})</insert>
+	<update name="Rename" args="id,name">update {{.table}} set ` + "`name`" + ` = {{arg .name}} where ` + "`id`" + ` = {{arg .id}}</update>
+</sago>`
+
+func newUserDao(t *testing.T) (*sago.Central, *UserDao, *sagotest.Mock) {
+	dir, err := ioutil.TempDir("", "sagotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "user.sql.xml"), []byte(userXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := sago.New()
+	if err := s.ScanDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	db, mock := sagotest.New()
+	dao := &UserDao{DB: db}
+	if err := s.Map(dao); err != nil {
+		t.Fatal(err)
+	}
+	return s, dao, mock
+}
+
+func TestExpectations(t *testing.T) {
+	_, dao, mock := newUserDao(t)
+	mock.ExpectQuery("select `id`,`name` from user where `id` in (?...)").
+		WithArgs(1, 2).
+		WillReturnRows(sagotest.NewRows("id", "name").AddRow(1, "foo").AddRow(2, "bar"))
+	mock.ExpectQuery("SELECT `id`,`name`   FROM user WHERE `id` = ?").
+		WithArgs(sagotest.AnyArg()).
+		WillReturnRows(sagotest.NewRows("id", "name"))
+	mock.ExpectExec("insert into user (`name`) values (?)").WithArgs("baz").WillReturnResult(7, 1)
+	mock.ExpectExec("update user set `name` = ? where `id` = ?").WillReturnError(errors.New("boom"))
+
+	users, err := dao.FindByIDs([]int64{1, 2})
+	if err != nil || len(users) != 2 || users[1].Name != "bar" {
+		t.Errorf("FindByIDs: %v %v", users, err)
+	}
+	if _, exist, err := dao.Find(3); err != nil || exist {
+		t.Errorf("Find: exist %v err %v", exist, err)
+	}
+	u := &User{Name: "baz"}
+	if affected, err := dao.Insert(u); err != nil || affected != 1 || u.ID != 7 {
+		t.Errorf("Insert: %v %v %+v", affected, err, u)
+	}
+	if err := dao.Rename(1, "x"); err == nil || err.Error() != "boom" {
+		t.Errorf("Rename: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnexpectedCalls(t *testing.T) {
+	_, dao, mock := newUserDao(t)
+	mock.ExpectQuery("select `id`,`name` from user where `id` = ?").WithArgs(1)
+	mock.ExpectExec("delete from user")
+
+	if _, _, err := dao.Find(2); err == nil {
+		t.Error("expected error for wrong args")
+	}
+	if _, err := dao.FindByIDs([]int64{1}); err == nil {
+		t.Error("expected error for unexpected query")
+	}
+	err := mock.ExpectationsWereMet()
+	if err == nil {
+		t.Fatal("expected unmet expectations")
+	}
+	for _, part := range []string{"arg 0: expected 1, got 2", "not called: exec \"delete from user\""} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("missing %q in %v", part, err)
+		}
+	}
+}
+
+// 每个 DB 只连接到自己的 Mock,包级别不保留 Mock
+func TestMocksAreScopedToDB(t *testing.T) {
+	db1, mock1 := sagotest.New()
+	defer db1.Close()
+	db2, mock2 := sagotest.New()
+	defer db2.Close()
+	mock1.ExpectExec("delete from user")
+	if _, err := db2.Exec("delete from user"); err == nil {
+		t.Error("expected db2 not to see mock1's expectations")
+	}
+	if _, err := db1.Exec("delete from user"); err != nil {
+		t.Error(err)
+	}
+	if err := mock1.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if err := mock2.ExpectationsWereMet(); err == nil {
+		t.Error("expected the unexpected exec on db2 to be reported")
+	}
+	if _, err := db1.Driver().Open("mock-1"); err == nil {
+		t.Error("expected opening a mock by dsn to fail")
+	}
+}
@@ -0,0 +1,115 @@
+package sagotest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mengxiaozhu/sago"
+)
+
+// 以包名限定,不与使用者测试包中常见的 -update 冲突
+var update = flag.Bool("sagotest.update", false, "update sagotest golden files")
+
+// 快照中一个函数的一组参数
+type Case struct {
+	Func string
+	// 同一函数有多组参数时区分快照
+	Name string
+	Args []interface{}
+}
+
+// Snapshot 使用的 testing.T 方法
+type T interface {
+	Helper()
+	Name() string
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// 渲染 dao 中每个生成的函数,与 testdata/<测试名>.golden 比较,go test -sagotest.update 时重写该文件
+// 没有 Case 的函数以参数的零值渲染,渲染错误也记录在快照中
+func Snapshot(t T, central *sago.Central, dao interface{}, cases []Case) {
+	t.Helper()
+	covered := map[string]bool{}
+	for _, c := range cases {
+		covered[c.Func] = true
+	}
+	for _, name := range central.MappedFuncs(dao) {
+		if !covered[name] {
+			cases = append(cases, Case{Func: name})
+		}
+	}
+	if len(cases) == 0 {
+		t.Fatalf("sagotest: no mapped funcs in %T", dao)
+	}
+
+	var buf bytes.Buffer
+	for _, c := range cases {
+		title := c.Func
+		if c.Name != "" {
+			title += "/" + c.Name
+		}
+		fmt.Fprintf(&buf, "-- %s --\n", title)
+		sqlText, sqlArgs, err := central.Render(dao, c.Func, c.Args...)
+		if err != nil {
+			fmt.Fprintf(&buf, "error: %v\n\n", err)
+			continue
+		}
+		fmt.Fprintf(&buf, "%s\nargs: %s\n\n", strings.TrimSpace(sqlText), formatArgs(sqlArgs))
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", strings.Replace(t.Name(), "/", "_", -1)+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("sagotest: %v", err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("sagotest: %v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("sagotest: %v (run go test -sagotest.update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("sagotest: rendered SQL differs from %s (run go test -sagotest.update to accept):\n%s", path, diffLines(string(want), string(got)))
+	}
+}
+
+func formatArgs(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			parts[i] = fmt.Sprintf("%q", s)
+		} else {
+			parts[i] = fmt.Sprintf("%v", arg)
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// 逐行比较,列出不同的行
+func diffLines(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "line %d:\n- %s\n+ %s\n", i+1, w, g)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package sagotest_test
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mengxiaozhu/sago/sagotest"
+)
+
+// 使用者的测试包常定义自己的 -update,不能与 sagotest 的 flag 冲突
+var _ = flag.Bool("update", false, "update the caller's own golden files")
+
+func TestSnapshot(t *testing.T) {
+	central, dao, _ := newUserDao(t)
+	sagotest.Snapshot(t, central, dao, []sagotest.Case{
+		{Func: "FindByIDs", Name: "two ids", Args: []interface{}{[]int64{1, 2}}},
+		{Func: "FindByIDs", Name: "empty", Args: []interface{}{[]int64{}}},
+		{Func: "Insert", Args: []interface{}{&User{Name: "foo"}}},
+	})
+}
+
+// 记录 Snapshot 的失败而不结束测试
+type recorder struct {
+	name   string
+	errors []string
+}
+
+func (r *recorder) Helper()      {}
+func (r *recorder) Name() string { return r.name }
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestSnapshotMismatch(t *testing.T) {
+	if flag.Lookup("sagotest.update").Value.String() == "true" {
+		t.Skip("compares against TestSnapshot.golden")
+	}
+	central, dao, _ := newUserDao(t)
+	r := &recorder{name: "TestSnapshot"}
+	sagotest.Snapshot(r, central, dao, []sagotest.Case{
+		{Func: "FindByIDs", Name: "two ids", Args: []interface{}{[]int64{1, 2, 3}}},
+	})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "+ select `id`,`name` from user where `id` in (?,?,?)") {
+		t.Errorf("expected a diff, got %v", r.errors)
+	}
+}
@@ -0,0 +1,362 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// VerifySchema 发现的结构体与表不一致
+type SchemaIssue struct {
+	DAO string
+	// insert 未覆盖 NOT NULL 列时为语句名
+	Statement string
+	Table     string
+	Column    string
+	Field     string
+	Problem   string
+}
+
+func (i SchemaIssue) String() string {
+	name := i.DAO
+	if i.Statement != "" {
+		name += "." + i.Statement
+	}
+	s := name + ": table " + i.Table
+	if i.Column != "" {
+		s += " column " + i.Column
+	}
+	if i.Field != "" {
+		s += " (" + i.Field + ")"
+	}
+	return s + ": " + i.Problem
+}
+
+// Map 时记录的语句,供 VerifySchema 检查
+type mappedStatement struct {
+	dao     string
+	name    string
+	fnType  string
+	targets []shardTarget
+	// 结构体的列应当都在表中
+	model reflect.Type
+	// insert 的列,无法解析时为 nil
+	insertColumns []string
+	executor      *SQLExecutor
+	argTypes      []reflect.Type
+}
+
+// 以 {{.fields}}/{{fields}}/{{fieldsExcept}} 列出模型列的 select 才检查模型,
+// 投影或聚合(如 select count(*) as total)读入的结构体不要求是表的列
+var fieldsPattern = regexp.MustCompile(`\{\{-?\s*(?:\.fields|fields|fieldsExcept)\b`)
+
+// 以 DAO 与函数名区分 Map 过的语句
+type statementKey struct {
+	dao  string
+	name string
+}
+
+// 再次 Map 同一 DAO 时替换之前记录的语句
+func (m *Central) addStatement(s *mappedStatement) {
+	key := statementKey{s.dao, s.name}
+	if i, ok := m.statementKeys[key]; ok {
+		m.statements[i] = s
+		return
+	}
+	if m.statementKeys == nil {
+		m.statementKeys = map[statementKey]int{}
+	}
+	m.statementKeys[key] = len(m.statements)
+	m.statements = append(m.statements, s)
+}
+
+var insertColumnsPattern = regexp.MustCompile("(?is)^\\s*(?:insert|replace)\\s+(?:ignore\\s+)?into\\s+[^\\s(]+\\s*\\(([^)]*)\\)")
+
+func newMappedStatement(dao string, e *SQLExecutor, argTypes []reflect.Type) *mappedStatement {
+	s := &mappedStatement{dao: dao, name: e.Fn.Name, fnType: e.Fn.Type, executor: e, argTypes: argTypes}
+	s.targets = e.shards
+	if s.targets == nil {
+		s.targets = []shardTarget{{e.DB, e.Table}}
+	}
+	switch e.Fn.Type {
+	case "select":
+		if e.resultMap == nil && !isDynamicResultType(e.ReturnTypes[0]) && fieldsPattern.MatchString(e.Fn.SQL) {
+			s.model = e.model
+		}
+	case "insert":
+		if len(argTypes) > 0 && (argTypes[0].Kind() == reflect.Struct || argTypes[0].Kind() == reflect.Ptr && argTypes[0].Elem().Kind() == reflect.Struct) {
+			s.model = findStructType(argTypes[0])
+		}
+		if sqlText, _, err := e.renderTpl(zeroArgs(argTypes), e.Table); err == nil {
+			if match := insertColumnsPattern.FindStringSubmatch(sqlText); match != nil {
+				for _, name := range strings.Split(match[1], ",") {
+					s.insertColumns = append(s.insertColumns, unquoteIdent(name))
+				}
+			}
+		}
+	}
+	return s
+}
+
+func unquoteIdent(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(strings.Trim(name, "`\"[]"))
+}
+
+// 表中的列
+type tableColumn struct {
+	name       string
+	dataType   string
+	notNull    bool
+	hasDefault bool
+	// 自增、identity 或生成列,insert 不需要提供
+	auto bool
+}
+
+// 无法识别驱动时不读取表结构,VerifySchema 将其记为 SchemaIssue
+var errUnknownDialect = errors.New("sago: unknown dialect")
+
+func readTableColumns(ctx context.Context, db *sql.DB, table string) (map[string]tableColumn, error) {
+	var rows *sql.Rows
+	var err error
+	switch dialect := DialectOf(db); dialect {
+	case MySQL:
+		rows, err = db.QueryContext(ctx, "select column_name, data_type, is_nullable = 'NO', column_default is not null, "+
+			"extra like '%auto_increment%' or extra like '%GENERATED%' "+
+			"from information_schema.columns where table_schema = database() and table_name = ?", table)
+	case Postgres:
+		rows, err = db.QueryContext(ctx, "select column_name, data_type, is_nullable = 'NO', column_default is not null, "+
+			"is_identity = 'YES' or is_generated = 'ALWAYS' "+
+			"from information_schema.columns where table_schema = current_schema() and table_name = $1", table)
+	case SQLite:
+		return readSQLiteColumns(ctx, db, table)
+	default:
+		return nil, errUnknownDialect
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]tableColumn{}
+	for rows.Next() {
+		var c tableColumn
+		if err := rows.Scan(&c.name, &c.dataType, &c.notNull, &c.hasDefault, &c.auto); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(c.name)] = c
+	}
+	return columns, rows.Err()
+}
+
+func readSQLiteColumns(ctx context.Context, db *sql.DB, table string) (map[string]tableColumn, error) {
+	rows, err := db.QueryContext(ctx, `PRAGMA table_info("`+strings.Replace(table, `"`, `""`, -1)+`")`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]tableColumn{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, dataType   string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = tableColumn{
+			name:       name,
+			dataType:   dataType,
+			notNull:    notNull == 1,
+			hasDefault: defaultValue.Valid,
+			// INTEGER PRIMARY KEY 是 rowid 的别名
+			auto: pk == 1 && strings.EqualFold(dataType, "INTEGER"),
+		}
+	}
+	return columns, rows.Err()
+}
+
+// 类型分类,无法判断时为空字符串
+const (
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+	typeString = "string"
+	typeTime   = "time"
+	typeBytes  = "bytes"
+)
+
+var (
+	nullStringType  = reflect.TypeOf(sql.NullString{})
+	nullInt64Type   = reflect.TypeOf(sql.NullInt64{})
+	nullFloat64Type = reflect.TypeOf(sql.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(sql.NullBool{})
+	bytesType       = reflect.TypeOf([]byte{})
+)
+
+func goTypeCategory(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case nullStringType:
+		return typeString
+	case nullInt64Type:
+		return typeInt
+	case nullFloat64Type:
+		return typeFloat
+	case nullBoolType:
+		return typeBool
+	case timeType:
+		return typeTime
+	case bytesType:
+		return typeBytes
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return typeInt
+	case reflect.Float32, reflect.Float64:
+		return typeFloat
+	case reflect.Bool:
+		return typeBool
+	case reflect.String:
+		return typeString
+	}
+	return ""
+}
+
+func dbTypeCategory(dataType string) string {
+	t := strings.ToLower(dataType)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = t[:i]
+	}
+	switch {
+	case strings.Contains(t, "int"), strings.Contains(t, "serial"):
+		return typeInt
+	case strings.Contains(t, "bool"), t == "bit":
+		return typeBool
+	case strings.Contains(t, "float"), strings.Contains(t, "double"), strings.Contains(t, "real"),
+		strings.Contains(t, "decimal"), strings.Contains(t, "numeric"):
+		return typeFloat
+	case strings.Contains(t, "char"), strings.Contains(t, "text"), strings.Contains(t, "clob"),
+		t == "enum", t == "set", t == "json", t == "jsonb", t == "uuid":
+		return typeString
+	case strings.Contains(t, "date"), strings.Contains(t, "time"):
+		return typeTime
+	case strings.Contains(t, "blob"), strings.Contains(t, "binary"), t == "bytea":
+		return typeBytes
+	}
+	return ""
+}
+
+// Go 类型可以读写的列类型
+var compatibleTypes = map[string][]string{
+	typeInt:    {typeInt, typeBool},
+	typeFloat:  {typeFloat, typeInt},
+	typeBool:   {typeBool, typeInt},
+	typeString: {typeString, typeBytes, typeTime, typeFloat},
+	typeTime:   {typeTime},
+	typeBytes:  {typeBytes, typeString},
+}
+
+func isCompatible(goType reflect.Type, dataType string) bool {
+	goCategory, dbCategory := goTypeCategory(goType), dbTypeCategory(dataType)
+	if goCategory == "" || dbCategory == "" {
+		return true
+	}
+	for _, c := range compatibleTypes[goCategory] {
+		if c == dbCategory {
+			return true
+		}
+	}
+	return false
+}
+
+type tableKey struct {
+	db    *sql.DB
+	table string
+}
+
+// 检查 Map 过的 DAO 与数据库中的表是否一致
+// 报告结构体中没有对应列的字段、insert 未提供的 NOT NULL 且无默认值的列,以及类型不匹配的列
+// 表的列从 information_schema(MySQL/Postgres)或 PRAGMA table_info(SQLite)读取
+// 没有 <table> 的 DAO 不检查,无法识别方言的 DB 记为 SchemaIssue
+func (m *Central) VerifySchema(ctx context.Context) ([]SchemaIssue, error) {
+	tables := map[tableKey]map[string]tableColumn{}
+	seen := map[string]bool{}
+	var issues []SchemaIssue
+	report := func(issue SchemaIssue) {
+		if key := issue.String(); !seen[key] {
+			seen[key] = true
+			issues = append(issues, issue)
+		}
+	}
+	unknown := map[tableKey]bool{}
+	for _, s := range m.statements {
+		for _, target := range s.targets {
+			// 没有 <table> 的 DAO 在语句中自行写表名,无从检查
+			if target.table == "" {
+				continue
+			}
+			key := tableKey{target.db.DB, target.table}
+			columns, ok := tables[key]
+			if !ok && !unknown[key] {
+				var err error
+				columns, err = readTableColumns(ctx, target.db.DB, target.table)
+				if err == errUnknownDialect {
+					unknown[key] = true
+				} else if err != nil {
+					return nil, err
+				}
+				tables[key] = columns
+			}
+			if unknown[key] {
+				report(SchemaIssue{DAO: s.dao, Table: target.table, Problem: "unknown dialect, not verified"})
+				continue
+			}
+			if len(columns) == 0 {
+				report(SchemaIssue{DAO: s.dao, Table: target.table, Problem: "table not found"})
+				continue
+			}
+			if s.model != nil {
+				for _, c := range columnsOf(s.model) {
+					field := s.model.Name() + "." + c.field
+					tc, ok := columns[strings.ToLower(c.name)]
+					if !ok {
+						report(SchemaIssue{DAO: s.dao, Table: target.table, Column: c.name, Field: field, Problem: "no such column"})
+					} else if !isCompatible(c.typ, tc.dataType) {
+						report(SchemaIssue{DAO: s.dao, Table: target.table, Column: c.name, Field: field,
+							Problem: fmt.Sprintf("%s cannot hold column type %s", c.typ, tc.dataType)})
+					}
+				}
+			}
+			if s.insertColumns != nil {
+				inserted := map[string]bool{}
+				for _, name := range s.insertColumns {
+					inserted[name] = true
+				}
+				var missing []string
+				for name, tc := range columns {
+					if tc.notNull && !tc.hasDefault && !tc.auto && !inserted[name] {
+						missing = append(missing, tc.name)
+					}
+				}
+				sort.Strings(missing)
+				for _, name := range missing {
+					report(SchemaIssue{DAO: s.dao, Statement: s.name, Table: target.table, Column: name,
+						Problem: "NOT NULL column without default is not inserted"})
+				}
+			}
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,122 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaUser struct {
+	ID      int64          `db:"id"`
+	Name    string         `db:"name"`
+	Age     sql.NullInt64  `db:"age"`
+	Created time.Time      `db:"created_at"`
+	Bio     sql.NullString `db:"bio"`
+}
+
+// 聚合查询读入的结构体,列不在表中
+type schemaStats struct {
+	Total int64 `db:"total"`
+}
+
+func TestTypeCompatibility(t *testing.T) {
+	cases := []struct {
+		goType   interface{}
+		dataType string
+		ok       bool
+	}{
+		{int64(0), "bigint", true},
+		{int64(0), "INTEGER", true},
+		{int64(0), "varchar", false},
+		{"", "varchar(255)", true},
+		{"", "decimal(10,2)", true},
+		{"", "int", false},
+		{time.Time{}, "datetime", true},
+		{time.Time{}, "text", false},
+		{true, "tinyint(1)", true},
+		{sql.NullInt64{}, "int", true},
+		{sql.NullString{}, "timestamp", true},
+		{[]byte{}, "blob", true},
+		{1.5, "double precision", true},
+		{1.5, "geometry", true},
+	}
+	for _, c := range cases {
+		if got := isCompatible(reflect.TypeOf(c.goType), c.dataType); got != c.ok {
+			t.Errorf("%T vs %s: got %v", c.goType, c.dataType, got)
+		}
+	}
+}
+
+func TestMappedStatement(t *testing.T) {
+	type schemaDao struct {
+		DB     *sql.DB
+		Find   func(id int64) (*schemaUser, error)
+		Insert func(u *schemaUser) (int64, error)
+		Stats  func() (map[string]interface{}, error)
+		Total  func() (*schemaStats, error)
+	}
+	m := newTestCentral(&File{Type: "schemaDao", Table: "user",
+		Selects: []SQLContent{
+			{Name: "Find", Args: "id", SQL: "select {{.fields}} from {{.table}} where id = {{arg .id}}"},
+			{Name: "Stats", SQL: "select count(*) as n from {{.table}}"},
+			{Name: "Total", SQL: "select count(*) as total from {{.table}}"},
+		},
+		Inserts: []SQLContent{{Name: "Insert", Args: "u", SQL: "insert into {{.table}} (`name`, `Age`) values ({{arg .u.Name}}, {{arg .u.Age}})"}},
+	})
+	db := openPrepareDB(t)
+	defer db.Close()
+	if err := m.Map(&schemaDao{DB: db.DB}); err != nil {
+		t.Fatal(err)
+	}
+	statements := map[string]*mappedStatement{}
+	for _, s := range m.statements {
+		statements[s.name] = s
+	}
+	if s := statements["Find"]; s.model != reflect.TypeOf(schemaUser{}) || s.targets[0].table != "user" {
+		t.Errorf("unexpected Find %+v", s)
+	}
+	if s := statements["Stats"]; s.model != nil {
+		t.Error("dynamic results have no model")
+	}
+	if s := statements["Total"]; s.model != nil {
+		t.Error("selects without fields have no model")
+	}
+	if s := statements["Insert"]; strings.Join(s.insertColumns, ",") != "name,age" || s.model != reflect.TypeOf(schemaUser{}) {
+		t.Errorf("unexpected Insert %+v", s)
+	}
+
+	issues, err := m.VerifySchema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].String() != "schemaDao: table user: unknown dialect, not verified" {
+		t.Errorf("expected one unknown dialect issue, got %v", issues)
+	}
+}
+
+func TestVerifySchemaSkipsDaoWithoutTable(t *testing.T) {
+	type rawDao struct {
+		DB    *sql.DB
+		Count func() (int64, error)
+	}
+	m := newTestCentral(&File{Type: "rawDao", Selects: []SQLContent{{Name: "Count", SQL: "select count(*) from user"}}})
+	db := openPrepareDB(t)
+	defer db.Close()
+	if err := m.Map(&rawDao{DB: db.DB}); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := m.VerifySchema(context.Background())
+	if err != nil || len(issues) != 0 {
+		t.Errorf("expected DAO without table skipped, got %v %v", issues, err)
+	}
+}
+
+func TestSchemaIssueString(t *testing.T) {
+	issue := SchemaIssue{DAO: "UserDao", Statement: "Insert", Table: "user", Column: "email", Problem: "NOT NULL column without default is not inserted"}
+	if issue.String() != "UserDao.Insert: table user column email: NOT NULL column without default is not inserted" {
+		t.Error(issue.String())
+	}
+}
@@ -0,0 +1,175 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 分片
+// DAO 声明 Sharding *sago.Sharding 字段后,语句按 shardKey 指定的参数选择分片
+// {{.table}} 为 <table> 加上分片的 Suffix
+type Shard struct {
+	DB     *sql.DB
+	Suffix string
+}
+
+// 根据 shardKey 参数的值返回分片下标
+type ShardFunc func(key interface{}) (int, error)
+
+type Sharding struct {
+	Shards []Shard
+	Func   ShardFunc
+}
+
+var shardingType = reflect.TypeOf(&Sharding{})
+
+func (s *Sharding) check() error {
+	if len(s.Shards) == 0 {
+		return errors.New("sharding has no shards")
+	}
+	if s.Func == nil {
+		return errors.New("sharding has no Func")
+	}
+	for i, shard := range s.Shards {
+		if shard.DB == nil {
+			return fmt.Errorf("shard %d has no DB", i)
+		}
+	}
+	return nil
+}
+
+// 分片的 DB 与物理表
+type shardTarget struct {
+	db    *sqlx.DB
+	table string
+}
+
+// 语句在 Map 时绑定分片,keyIndex 为 shardKey 在 args 中的位置,没有 shardKey 时为 -1
+func (e *SQLExecutor) setSharding(sharding *Sharding, keyIndex int) {
+	e.shards = make([]shardTarget, len(sharding.Shards))
+	for i, shard := range sharding.Shards {
+		e.shards[i] = shardTarget{
+			db:    sqlx.NewDb(shard.DB, e.DB.DriverName()),
+			table: e.Table + shard.Suffix,
+		}
+	}
+	e.shardFunc = sharding.Func
+	e.shardKeyIndex = keyIndex
+}
+
+func (e *SQLExecutor) shardFor(args []reflect.Value) (shardTarget, error) {
+	i, err := e.shardFunc(args[e.shardKeyIndex].Interface())
+	if err != nil {
+		return shardTarget{}, err
+	}
+	if i < 0 || i >= len(e.shards) {
+		return shardTarget{}, fmt.Errorf("sago: shard index %d out of range [0,%d)", i, len(e.shards))
+	}
+	return e.shards[i], nil
+}
+
+// 写语句使用的 DB 与 SQL,分片时按 shardKey 选择
+func (e *SQLExecutor) renderWrite(args []reflect.Value) (*sqlx.DB, string, []interface{}, error) {
+	if e.shards == nil {
+		sqlText, sqlArgs, err := e.executeTpl(args)
+		return e.DB, sqlText, sqlArgs, err
+	}
+	target, err := e.shardFor(args)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	sqlText, sqlArgs, err := e.renderTpl(args, target.table)
+	return target.db, sqlText, sqlArgs, err
+}
+
+// 有 shardKey 时只查询一个分片,否则依次查询所有分片并合并结果
+// 没有 shardKey 的 select 只能返回 slice 或 map,已在 Map 时检查
+func (e *SQLExecutor) selectShards(ctx context.Context, args []reflect.Value) (reflect.Value, error) {
+	resultType := e.ReturnTypes[0]
+	if e.shardKeyIndex >= 0 {
+		target, err := e.shardFor(args)
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		sqlString, sqlArgs, err := e.renderTpl(args, target.table)
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		return e.retryQuery(ctx, target.db, sqlString, sqlArgs)
+	}
+	var merged reflect.Value
+	for i, target := range e.shards {
+		sqlString, sqlArgs, err := e.renderTpl(args, target.table)
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		value, err := e.retryQuery(ctx, target.db, sqlString, sqlArgs)
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		if i == 0 {
+			merged = value
+		} else {
+			merged = mergeShardResult(merged, value)
+		}
+	}
+	return merged, nil
+}
+
+func isMergeable(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Slice || (typ.Kind() == reflect.Map && typ != rowMapType)
+}
+
+func mergeShardResult(merged, value reflect.Value) reflect.Value {
+	if merged.Kind() == reflect.Slice {
+		// [][]interface{} 的第一行为列名
+		if merged.Type().Elem() == rowSliceType && value.Len() > 0 {
+			value = value.Slice(1, value.Len())
+		}
+		return reflect.AppendSlice(merged, value)
+	}
+	grouped := merged.Type().Elem().Kind() == reflect.Slice
+	for _, key := range value.MapKeys() {
+		item := value.MapIndex(key)
+		if existing := merged.MapIndex(key); grouped && existing.IsValid() {
+			item = reflect.AppendSlice(existing, item)
+		}
+		merged.SetMapIndex(key, item)
+	}
+	return merged
+}
+
+// 分片的 DAO 中写语句必须声明 shardKey
+func bindSharding(e *SQLExecutor, fn *Fn, sharding *Sharding) error {
+	keyIndex := -1
+	if fn.ShardKey != "" {
+		for i, arg := range fn.Args {
+			if arg == fn.ShardKey {
+				keyIndex = i
+			}
+		}
+		if keyIndex < 0 {
+			return fmt.Errorf("shardKey %s is not in args", fn.ShardKey)
+		}
+	}
+	if sharding == nil {
+		if keyIndex >= 0 {
+			return errors.New("shardKey declared but the DAO has no Sharding")
+		}
+		return nil
+	}
+	if keyIndex < 0 && fn.Type != "select" {
+		return errors.New(fn.Type + " on a sharded DAO must declare shardKey")
+	}
+	// 查询所有分片时单个结果(如 count(*))无法合并,只查到一个分片的结果是错误的
+	if keyIndex < 0 && !isMergeable(e.ReturnTypes[0]) {
+		return fmt.Errorf("select across shards cannot merge %s, return a slice or map or declare shardKey", e.ReturnTypes[0])
+	}
+	e.setSharding(sharding, keyIndex)
+	return nil
+}
@@ -0,0 +1,115 @@
+package sago
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type shardedDao struct {
+	Sharding *Sharding
+	Find     func(userID int64) (int64, error)
+	FindAll  func() ([]int64, error)
+	Save     func(userID int64, name string) error
+}
+
+func newShardedCentral(save SQLContent) *Central {
+	return newTestCentral(&File{Type: "shardedDao", Table: "orders",
+		Selects: []SQLContent{
+			{Name: "Find", Args: "userID", ShardKey: "userID", SQL: "select id from {{.table}} where user_id = {{arg .userID}}"},
+			{Name: "FindAll", SQL: "select id from {{.table}}"},
+		},
+		Executes: []SQLContent{save},
+	})
+}
+
+func testSharding() *Sharding {
+	return &Sharding{
+		Shards: []Shard{{DB: &sql.DB{}, Suffix: "_0"}, {DB: &sql.DB{}, Suffix: "_1"}},
+		Func: func(key interface{}) (int, error) {
+			id, ok := key.(int64)
+			if !ok {
+				return 0, errors.New("bad shard key")
+			}
+			return int(id % 2), nil
+		},
+	}
+}
+
+func TestShardingMap(t *testing.T) {
+	save := SQLContent{Name: "Save", Args: "userID,name", ShardKey: "userID", SQL: "insert into {{.table}} (user_id, name) values ({{arg .userID}}, {{arg .name}})"}
+	sharding := testSharding()
+	if err := newShardedCentral(save).Map(&shardedDao{Sharding: sharding}); err != nil {
+		t.Fatal(err)
+	}
+
+	save.ShardKey = ""
+	if err := newShardedCentral(save).Map(&shardedDao{Sharding: sharding}); err == nil {
+		t.Error("expected error for write without shardKey")
+	}
+	save.ShardKey = "missing"
+	if err := newShardedCentral(save).Map(&shardedDao{Sharding: sharding}); err == nil {
+		t.Error("expected error for shardKey not in args")
+	}
+	if err := newShardedCentral(save).Map(&shardedDao{Sharding: &Sharding{}}); err == nil {
+		t.Error("expected error for empty sharding")
+	}
+
+	// 没有 shardKey 的 count(*) 只能得到一个分片的结果
+	type countDao struct {
+		Sharding *Sharding
+		Count    func() (int64, error)
+	}
+	m := newTestCentral(&File{Type: "countDao", Table: "orders",
+		Selects: []SQLContent{{Name: "Count", SQL: "select count(*) from {{.table}}"}},
+	})
+	if err := m.Map(&countDao{Sharding: sharding}); err == nil {
+		t.Error("expected error for unmergeable select across shards")
+	}
+}
+
+func TestShardRender(t *testing.T) {
+	m := New()
+	fn := &Fn{Name: "Save", Args: []string{"userID"}, SQL: "delete from {{.table}} where user_id = {{arg .userID}}"}
+	tpl, _ := m.parseTemplate(fn)
+	e := NewSQLExecutor("orders", "shardedDao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	sharding := testSharding()
+	e.setSharding(sharding, 0)
+
+	db, sqlText, sqlArgs, err := e.renderWrite([]reflect.Value{reflect.ValueOf(int64(3))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.DB != sharding.Shards[1].DB || sqlText != "delete from orders_1 where user_id = ?" || sqlArgs[0] != int64(3) {
+		t.Error(sqlText, sqlArgs)
+	}
+	if _, _, _, err := e.renderWrite([]reflect.Value{reflect.ValueOf("x")}); err == nil {
+		t.Error("expected shard func error")
+	}
+	e.shardFunc = func(interface{}) (int, error) { return 5, nil }
+	if _, _, _, err := e.renderWrite([]reflect.Value{reflect.ValueOf(int64(1))}); err == nil {
+		t.Error("expected out of range error")
+	}
+}
+
+func TestMergeShardResult(t *testing.T) {
+	ids := mergeShardResult(reflect.ValueOf([]int64{1, 2}), reflect.ValueOf([]int64{3}))
+	if !reflect.DeepEqual(ids.Interface(), []int64{1, 2, 3}) {
+		t.Error(ids)
+	}
+	rows := mergeShardResult(
+		reflect.ValueOf([][]interface{}{{"id"}, {1}}),
+		reflect.ValueOf([][]interface{}{{"id"}, {2}}),
+	)
+	if !reflect.DeepEqual(rows.Interface(), [][]interface{}{{"id"}, {1}, {2}}) {
+		t.Error(rows)
+	}
+	grouped := mergeShardResult(
+		reflect.ValueOf(map[int][]string{1: {"a"}}),
+		reflect.ValueOf(map[int][]string{1: {"b"}, 2: {"c"}}),
+	)
+	if !reflect.DeepEqual(grouped.Interface(), map[int][]string{1: {"a", "b"}, 2: {"c"}}) {
+		t.Error(grouped)
+	}
+}
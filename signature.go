@@ -0,0 +1,162 @@
+package sago
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// insert/execute/update/delete 支持的返回值
+type execReturn int
+
+const (
+	execReturnError      execReturn = iota // (error)
+	execReturnAffected                     // (affected int64|int, error)
+	execReturnResult                       // (sql.Result, error)
+	execReturnIDAffected                   // (lastID int64|int, affected int64|int, error)
+	execReturnBool                         // (affected > 0 bool, error)
+)
+
+var sqlResultType = reflect.TypeOf((*sql.Result)(nil)).Elem()
+
+func isIntType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Int64 || typ.Kind() == reflect.Int
+}
+
+// 在 Map 时检查写语句的返回值声明
+func checkExecReturns(returnTypes []reflect.Type) (execReturn, error) {
+	n := len(returnTypes)
+	if n == 0 || returnTypes[n-1] != emptyErrorType {
+		return 0, fmt.Errorf("last return value must be error, but got %v", returnTypes)
+	}
+	switch n {
+	case 1:
+		return execReturnError, nil
+	case 2:
+		switch first := returnTypes[0]; {
+		case first == sqlResultType:
+			return execReturnResult, nil
+		case first.Kind() == reflect.Bool:
+			return execReturnBool, nil
+		case isIntType(first):
+			return execReturnAffected, nil
+		}
+	case 3:
+		if isIntType(returnTypes[0]) && isIntType(returnTypes[1]) {
+			return execReturnIDAffected, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported returns %v, expected (error), (int64|int, error), (sql.Result, error), (bool, error) or (lastID, affected int64|int, error)", returnTypes)
+}
+
+// 可以直接作为 select 单行结果的类型
+func isSelectValueType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Struct,
+		reflect.Bool,
+		reflect.String,
+		reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64,
+		reflect.Uint,
+		reflect.Uint8,
+		reflect.Uint16,
+		reflect.Uint32,
+		reflect.Uint64,
+		reflect.Float32,
+		reflect.Float64:
+		return true
+	case reflect.Ptr:
+		return typ.Elem().Kind() != reflect.Ptr && isSelectValueType(typ.Elem())
+	}
+	return false
+}
+
+func isSelectResultType(typ reflect.Type) bool {
+	if isDynamicResultType(typ) {
+		return true
+	}
+	if typ.Kind() == reflect.Slice {
+		return isSelectValueType(typ.Elem())
+	}
+	return isSelectValueType(typ)
+}
+
+func isResultMapType(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct
+}
+
+// 在 Map 时检查 select 的返回值声明,只支持 (T, error) 和 (T, exist bool, error)
+func checkSelectReturns(returnTypes []reflect.Type, fn *Fn) error {
+	n := len(returnTypes)
+	if (n != 2 && n != 3) || returnTypes[n-1] != emptyErrorType {
+		return fmt.Errorf("unsupported returns %v, select only support (T, error) or (T, exist bool, error)", returnTypes)
+	}
+	if n == 3 && returnTypes[1].Kind() != reflect.Bool {
+		return fmt.Errorf("second return value must be bool, but got %s", returnTypes[1])
+	}
+	if fn.ResultMap != nil {
+		if !isResultMapType(returnTypes[0]) {
+			return fmt.Errorf("select with resultMap must return T, *T, []T or []*T of struct, but got %s", returnTypes[0])
+		}
+		return nil
+	}
+	if fn.Key != "" {
+		if keyedStructType(returnTypes[0]) == nil {
+			return fmt.Errorf("select with key must return map[K]V or map[K][]V of struct, but got %s", returnTypes[0])
+		}
+		return nil
+	}
+	if !isSelectResultType(returnTypes[0]) {
+		return fmt.Errorf("unsupported select result type %s", returnTypes[0])
+	}
+	return nil
+}
+
+var anyPattern = regexp.MustCompile(`\bany\b`)
+
+// 可变参数在模板中为切片,可声明为 ids:...int64 或 ids:[]int64
+func matchArgType(declared string, fnType reflect.Type, i int) bool {
+	if strings.HasPrefix(declared, "...") {
+		if !fnType.IsVariadic() || i != fnType.NumIn()-1 {
+			return false
+		}
+		declared = "[]" + declared[len("..."):]
+	}
+	return matchTypeName(declared, fnType.In(i))
+}
+
+// args 中声明的类型与函数参数类型是否一致
+// 可以写完整类型 *main.User,也可以省略包名 *User,any 等同 interface{}
+func matchTypeName(declared string, typ reflect.Type) bool {
+	declared = strings.Replace(declared, " ", "", -1)
+	declared = anyPattern.ReplaceAllString(declared, "interface{}")
+	return declared == strings.Replace(typ.String(), " ", "", -1) || declared == shortTypeName(typ)
+}
+
+func shortTypeName(typ reflect.Type) string {
+	if typ.Name() != "" {
+		return typ.Name()
+	}
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return "*" + shortTypeName(typ.Elem())
+	case reflect.Slice:
+		return "[]" + shortTypeName(typ.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]", typ.Len()) + shortTypeName(typ.Elem())
+	case reflect.Map:
+		return "map[" + shortTypeName(typ.Key()) + "]" + shortTypeName(typ.Elem())
+	}
+	return strings.Replace(typ.String(), " ", "", -1)
+}
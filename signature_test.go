@@ -0,0 +1,225 @@
+package sago
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mengxiaozhu/linkerror"
+)
+
+type fakeResult struct {
+	id, affected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+func newTestCentral(files ...*File) *Central {
+	m := New()
+	m.files = append(m.files, files...)
+	return m
+}
+
+func TestExecSignatures(t *testing.T) {
+	for _, c := range []struct {
+		fn interface{}
+		ok bool
+	}{
+		{func() error { return nil }, true},
+		{func() (int64, error) { return 0, nil }, true},
+		{func() (int, error) { return 0, nil }, true},
+		{func() (sql.Result, error) { return nil, nil }, true},
+		{func() (bool, error) { return false, nil }, true},
+		{func() (int64, int64, error) { return 0, 0, nil }, true},
+		{func() {}, false},
+		{func() int64 { return 0 }, false},
+		{func() (string, error) { return "", nil }, false},
+		{func() (int64, bool, error) { return 0, false, nil }, false},
+	} {
+		typ := reflect.TypeOf(c.fn)
+		returnTypes := make([]reflect.Type, typ.NumOut())
+		for i := range returnTypes {
+			returnTypes[i] = typ.Out(i)
+		}
+		_, err := checkExecReturns(returnTypes)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: expected ok=%v, got %v", typ, c.ok, err)
+		}
+	}
+}
+
+type execSignatureDao struct {
+	DB     *sql.DB
+	Insert func() (string, error)
+}
+
+func TestExecSignatureCheckedAtMap(t *testing.T) {
+	m := newTestCentral(&File{
+		Type:    "execSignatureDao",
+		Inserts: []SQLContent{{Name: "Insert", SQL: "insert into t values (1)"}},
+	})
+	if err := m.Map(&execSignatureDao{}); err == nil {
+		t.Fatal("expected Map to reject (string, error)")
+	}
+}
+
+func TestReturnResult(t *testing.T) {
+	rs := fakeResult{id: 7, affected: 2}
+	for _, c := range []struct {
+		fn     interface{}
+		expect []interface{}
+	}{
+		{func() (int64, error) { return 0, nil }, []interface{}{int64(2)}},
+		{func() (int, error) { return 0, nil }, []interface{}{2}},
+		{func() (bool, error) { return false, nil }, []interface{}{true}},
+		{func() (int64, int, error) { return 0, 0, nil }, []interface{}{int64(7), 2}},
+		{func() (sql.Result, error) { return nil, nil }, []interface{}{rs}},
+	} {
+		typ := reflect.TypeOf(c.fn)
+		e := &SQLExecutor{}
+		for i := 0; i < typ.NumOut(); i++ {
+			e.ReturnTypes = append(e.ReturnTypes, typ.Out(i))
+		}
+		var err error
+		if e.execReturn, err = checkExecReturns(e.ReturnTypes); err != nil {
+			t.Fatal(err)
+		}
+		results := e.returnResult(rs)
+		for i, v := range c.expect {
+			if !reflect.DeepEqual(results[i].Interface(), v) {
+				t.Errorf("%s: result %d expected %v, got %v", typ, i, v, results[i].Interface())
+			}
+		}
+		if !results[len(results)-1].IsNil() {
+			t.Errorf("%s: unexpected error", typ)
+		}
+	}
+}
+
+type selectSignatureUser struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestSelectSignatures(t *testing.T) {
+	for _, c := range []struct {
+		fn interface{}
+		ok bool
+	}{
+		{func() ([]selectSignatureUser, error) { return nil, nil }, true},
+		{func() ([]*selectSignatureUser, error) { return nil, nil }, true},
+		{func() ([]int64, error) { return nil, nil }, true},
+		{func() (*selectSignatureUser, error) { return nil, nil }, true},
+		{func() (selectSignatureUser, error) { return selectSignatureUser{}, nil }, true},
+		{func() (*selectSignatureUser, bool, error) { return nil, false, nil }, true},
+		{func() (string, bool, error) { return "", false, nil }, true},
+		{func() (float64, error) { return 0, nil }, true},
+		{func() (*int, error) { return nil, nil }, true},
+		{func() (map[string]interface{}, error) { return nil, nil }, true},
+		{func() (map[string]interface{}, bool, error) { return nil, false, nil }, true},
+		{func() ([]map[string]interface{}, error) { return nil, nil }, true},
+		{func() ([][]interface{}, error) { return nil, nil }, true},
+		{func() (map[string]string, error) { return nil, nil }, false},
+		{func() ([]interface{}, error) { return nil, nil }, false},
+		{func() error { return nil }, false},
+		{func() []selectSignatureUser { return nil }, false},
+		{func() (selectSignatureUser, int, error) { return selectSignatureUser{}, 0, nil }, false},
+		{func() (selectSignatureUser, bool, error, error) { return selectSignatureUser{}, false, nil, nil }, false},
+		{func() ([2]selectSignatureUser, error) { return [2]selectSignatureUser{}, nil }, false},
+		{func() (chan int, error) { return nil, nil }, false},
+		{func() (interface{}, error) { return nil, nil }, false},
+		{func() (**selectSignatureUser, error) { return nil, nil }, false},
+		{func() ([][]int, error) { return nil, nil }, false},
+	} {
+		typ := reflect.TypeOf(c.fn)
+		returnTypes := make([]reflect.Type, typ.NumOut())
+		for i := range returnTypes {
+			returnTypes[i] = typ.Out(i)
+		}
+		err := checkSelectReturns(returnTypes, &Fn{})
+		if (err == nil) != c.ok {
+			t.Errorf("%s: expected ok=%v, got %v", typ, c.ok, err)
+		}
+	}
+}
+
+type selectSignatureDao struct {
+	DB       *sql.DB
+	FindByID func(id int64) (chan int, error)
+}
+
+func TestSelectSignatureCheckedAtMap(t *testing.T) {
+	m := newTestCentral(&File{
+		Type:    "selectSignatureDao",
+		Selects: []SQLContent{{Name: "FindByID", Args: "id", SQL: "select 1"}},
+	})
+	err := m.Map(&selectSignatureDao{})
+	linkErr, ok := err.(*linkerror.Error)
+	if !ok || !linkErr.Catch(XMLMappedWrong) {
+		t.Fatalf("expected XMLMappedWrong, got %v", err)
+	}
+	for _, s := range []string{"selectSignatureDao", "FindByID", "chan int"} {
+		if !strings.Contains(linkErr.Msg, s) {
+			t.Errorf("error %q should mention %q", linkErr.Msg, s)
+		}
+	}
+}
+
+func TestStrToArgs(t *testing.T) {
+	names, types := strToArgs(" name:string, ids : []int64,u:*User, m:map[string]int, plain ,")
+	if !reflect.DeepEqual(names, []string{"name", "ids", "u", "m", "plain"}) {
+		t.Error(names)
+	}
+	if !reflect.DeepEqual(types, []string{"string", "[]int64", "*User", "map[string]int", ""}) {
+		t.Error(types)
+	}
+}
+
+type Company struct{}
+
+func TestMatchTypeName(t *testing.T) {
+	for _, c := range []struct {
+		declared string
+		value    interface{}
+		ok       bool
+	}{
+		{"string", "", true},
+		{"[]int64", []int64{}, true},
+		{"*selectSignatureUser", &selectSignatureUser{}, true},
+		{"*sago.selectSignatureUser", &selectSignatureUser{}, true},
+		{"[]*selectSignatureUser", []*selectSignatureUser{}, true},
+		{"map[string]int", map[string]int{}, true},
+		{"map[string]any", map[string]interface{}{}, true},
+		{"*Company", &Company{}, true},
+		{"int", int64(0), false},
+		{"selectSignatureUser", &selectSignatureUser{}, false},
+		{"*other.selectSignatureUser", &selectSignatureUser{}, false},
+	} {
+		if matchTypeName(c.declared, reflect.TypeOf(c.value)) != c.ok {
+			t.Errorf("%s vs %T: expected %v", c.declared, c.value, c.ok)
+		}
+	}
+}
+
+type typedArgsDao struct {
+	DB   *sql.DB
+	Find func(id int64, name string) (*selectSignatureUser, error)
+}
+
+func TestTypedArgsCheckedAtMap(t *testing.T) {
+	for args, ok := range map[string]bool{
+		"id:int64, name:string": true,
+		"id, name:string":       true,
+		"id:string, name:int64": false,
+	} {
+		m := newTestCentral(&File{
+			Type:    "typedArgsDao",
+			Selects: []SQLContent{{Name: "Find", Args: args, SQL: "select 1"}},
+		})
+		if err := m.Map(&typedArgsDao{}); (err == nil) != ok {
+			t.Errorf("%s: expected ok=%v, got %v", args, ok, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+)
+
+// 列未知时的动态结果
+// map[string]interface{}     单行,列名 -> 值
+// []map[string]interface{}   多行,列名 -> 值
+// [][]interface{}            多行,第一行为列名
+var (
+	rowMapType   = reflect.TypeOf(map[string]interface{}{})
+	rowSliceType = reflect.TypeOf([]interface{}{})
+)
+
+func isDynamicResultType(typ reflect.Type) bool {
+	if typ == rowMapType {
+		return true
+	}
+	return typ.Kind() == reflect.Slice && (typ.Elem() == rowMapType || typ.Elem() == rowSliceType)
+}
+
+// 二进制列保留 []byte,其余列的 []byte 转为 string
+func isBinaryColumn(databaseTypeName string) bool {
+	name := strings.ToUpper(databaseTypeName)
+	return strings.HasSuffix(name, "BLOB") || strings.HasSuffix(name, "BINARY") ||
+		name == "BYTEA" || name == "BIT" || name == "GEOMETRY"
+}
+
+func normalizeBytes(v interface{}, binary bool) interface{} {
+	if b, ok := v.([]byte); ok && !binary {
+		return string(b)
+	}
+	return v
+}
+
+func (e *SQLExecutor) selectDynamic(ctx context.Context, r runner, resultType reflect.Type, sqlString string, sqlArgs []interface{}) (reflect.Value, error) {
+	rows, err := r.QueryxContext(ctx, sqlString, sqlArgs...)
+	if err != nil {
+		return reflect.Zero(resultType), err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return reflect.Zero(resultType), err
+	}
+	binary := make([]bool, len(columns))
+	if columnTypes, err := rows.ColumnTypes(); err == nil {
+		for i, columnType := range columnTypes {
+			binary[i] = isBinaryColumn(columnType.DatabaseTypeName())
+		}
+	}
+	scanMap := func() (map[string]interface{}, error) {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		for i, column := range columns {
+			row[column] = normalizeBytes(row[column], binary[i])
+		}
+		return row, nil
+	}
+
+	if resultType == rowMapType {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return reflect.Zero(resultType), err
+			}
+			return reflect.Zero(resultType), sql.ErrNoRows
+		}
+		row, err := scanMap()
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		return reflect.ValueOf(row), nil
+	}
+
+	list := reflect.MakeSlice(resultType, 0, 0)
+	if resultType.Elem() == rowSliceType {
+		header := make([]interface{}, len(columns))
+		for i, column := range columns {
+			header[i] = column
+		}
+		list = reflect.Append(list, reflect.ValueOf(header))
+	}
+	for rows.Next() {
+		if resultType.Elem() == rowMapType {
+			row, err := scanMap()
+			if err != nil {
+				return reflect.Zero(resultType), err
+			}
+			list = reflect.Append(list, reflect.ValueOf(row))
+			continue
+		}
+		row, err := rows.SliceScan()
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		for i := range row {
+			row[i] = normalizeBytes(row[i], binary[i])
+		}
+		list = reflect.Append(list, reflect.ValueOf(row))
+	}
+	if err := rows.Err(); err != nil {
+		return reflect.Zero(resultType), err
+	}
+	return list, nil
+}
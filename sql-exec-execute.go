@@ -1,7 +1,11 @@
 package sago
 
 import (
+	"context"
+	"database/sql"
 	"reflect"
+
+	"github.com/jmoiron/sqlx"
 )
 
 var (
@@ -22,44 +26,71 @@ func (e *SQLExecutor) returnError(err error) (results []reflect.Value) {
 }
 
 func (e *SQLExecutor) Insert(args []reflect.Value) (results []reflect.Value) {
-	sqlText, sqlArgs, err := e.executeTpl(args)
+	ctx, args := e.splitArgs(args)
+	db, sqlText, sqlArgs, err := e.renderWrite(args)
 
 	if err != nil {
 		return e.returnError(err)
 	}
-	rs, err := e.DB.Exec(sqlText, sqlArgs...)
+	rs, err := e.exec(ctx, db, sqlText, sqlArgs)
 
 	if err != nil {
 		return e.returnError(err)
 	}
-	firstArg := args[0]
-	if firstArg.Kind() == reflect.Ptr && firstArg.Elem().Kind() == reflect.Struct {
-		idField := firstArg.Elem().FieldByName("Id")
-		empty := reflect.Value{}
-		if idField == empty {
-			idField = firstArg.Elem().FieldByName("ID")
-		}
-		if idField != empty {
-			id, _ := rs.LastInsertId()
-			idField.SetInt(id)
+	if len(args) > 0 {
+		firstArg := args[0]
+		if firstArg.Kind() == reflect.Ptr && !firstArg.IsNil() && firstArg.Elem().Kind() == reflect.Struct {
+			idField := firstArg.Elem().FieldByName("Id")
+			empty := reflect.Value{}
+			if idField == empty {
+				idField = firstArg.Elem().FieldByName("ID")
+			}
+			if idField != empty && idField.Kind() >= reflect.Int && idField.Kind() <= reflect.Int64 {
+				id, _ := rs.LastInsertId()
+				idField.SetInt(id)
+			}
 		}
 	}
-	var nilError error
-	affected, _ := rs.RowsAffected()
-	if e.ReturnTypes[0].Kind() == reflect.Int64 {
-		return []reflect.Value{
-			reflect.ValueOf(affected),
-			reflect.ValueOf(&nilError).Elem(),
+	return e.returnResult(rs)
+}
+
+// 写语句,声明了 idempotent 时遇到临时错误重试
+func (e *SQLExecutor) exec(parent context.Context, db *sqlx.DB, sqlText string, sqlArgs []interface{}) (rs sql.Result, err error) {
+	ctx, cancel := e.withTimeout(parent)
+	defer cancel()
+	err = e.withRetry(ctx, db, true, func() error {
+		r, release, err := e.runner(ctx, db, sqlText)
+		if err != nil {
+			return err
 		}
-	}
-	if e.ReturnTypes[0].Kind() == reflect.Int {
+		defer release()
+		rs, err = r.ExecContext(ctx, sqlText, sqlArgs...)
+		return err
+	})
+	return rs, timeoutError(parent, ctx, err)
+}
+
+// 按 Map 时确定的返回值形式组装结果
+func (e *SQLExecutor) returnResult(rs sql.Result) (results []reflect.Value) {
+	var nilError error
+	errValue := reflect.ValueOf(&nilError).Elem()
+	switch e.execReturn {
+	case execReturnResult:
+		return []reflect.Value{reflect.ValueOf(&rs).Elem(), errValue}
+	case execReturnAffected:
+		affected, _ := rs.RowsAffected()
+		return []reflect.Value{reflect.ValueOf(affected).Convert(e.ReturnTypes[0]), errValue}
+	case execReturnBool:
+		affected, _ := rs.RowsAffected()
+		return []reflect.Value{reflect.ValueOf(affected > 0).Convert(e.ReturnTypes[0]), errValue}
+	case execReturnIDAffected:
+		id, _ := rs.LastInsertId()
+		affected, _ := rs.RowsAffected()
 		return []reflect.Value{
-			reflect.ValueOf(int(affected)),
-			reflect.ValueOf(&nilError).Elem(),
+			reflect.ValueOf(id).Convert(e.ReturnTypes[0]),
+			reflect.ValueOf(affected).Convert(e.ReturnTypes[1]),
+			errValue,
 		}
 	}
-	if len(e.ReturnTypes) == 1 {
-		return e.returnError(nilError)
-	}
-	panic("NOT SUPPORT")
+	return []reflect.Value{errValue}
 }
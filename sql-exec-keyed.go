@@ -0,0 +1,84 @@
+package sago
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// select 声明 key="id" 时可返回 map[K]V 或按 key 分组的 map[K][]V
+// V 为结构体或结构体指针,key 为列名或字段名
+func keyedStructType(typ reflect.Type) reflect.Type {
+	if typ.Kind() != reflect.Map {
+		return nil
+	}
+	value := typ.Elem()
+	if value.Kind() == reflect.Slice {
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	return value
+}
+
+// 查找 key 对应的字段下标,优先按列名,其次按字段名
+func (e *SQLExecutor) resolveKey() error {
+	resultType := e.ReturnTypes[0]
+	structType := keyedStructType(resultType)
+	if structType == nil {
+		return fmt.Errorf("key %s requires map[K]V or map[K][]V of struct, but got %s", e.Fn.Key, resultType)
+	}
+	index := e.DB.Mapper.TraversalsByName(structType, []string{e.Fn.Key})[0]
+	if len(index) == 0 {
+		field, ok := structType.FieldByName(e.Fn.Key)
+		if !ok {
+			return fmt.Errorf("key %s is neither a column nor a field of %s", e.Fn.Key, structType)
+		}
+		index = field.Index
+	}
+	if fieldType := structType.FieldByIndex(index).Type; !isKeyConvertible(fieldType, resultType.Key()) {
+		return fmt.Errorf("key %s of type %s cannot be converted to %s", e.Fn.Key, fieldType, resultType.Key())
+	}
+	e.keyIndex = index
+	return nil
+}
+
+// 不允许 int -> string 这类按 rune 转换,Render 的参数也按此转换
+func isKeyConvertible(from, to reflect.Type) bool {
+	if from.AssignableTo(to) {
+		return true
+	}
+	if (from.Kind() == reflect.String) != (to.Kind() == reflect.String) {
+		return false
+	}
+	return from.ConvertibleTo(to)
+}
+
+// list 为查询出的 []V,按 key 组装成结果 map
+func (e *SQLExecutor) toKeyedMap(list reflect.Value) reflect.Value {
+	resultType := e.ReturnTypes[0]
+	grouped := resultType.Elem().Kind() == reflect.Slice
+	result := reflect.MakeMapWithSize(resultType, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		item := list.Index(i)
+		st := item
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		key := reflectx.FieldByIndexesReadOnly(st, e.keyIndex).Convert(resultType.Key())
+		if grouped {
+			group := result.MapIndex(key)
+			if !group.IsValid() {
+				group = reflect.MakeSlice(resultType.Elem(), 0, 1)
+			}
+			item = reflect.Append(group, item)
+		}
+		result.SetMapIndex(key, item)
+	}
+	return result
+}
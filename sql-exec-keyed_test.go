@@ -0,0 +1,106 @@
+package sago
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+type keyedOrder struct {
+	OrderID int64 `db:"order_id"`
+	UserID  int64 `db:"user_id"`
+}
+
+type keyedDao struct {
+	DB          *sql.DB
+	ByID        func(ids []int) (map[int]keyedOrder, error)
+	ByUser      func(ids []int) (map[int64][]*keyedOrder, error)
+	ByFieldName func() (map[int64]*keyedOrder, error)
+	BadKey      func() (map[int64]keyedOrder, error)
+	BadKeyType  func() (map[string]keyedOrder, error)
+}
+
+func mapKeyedDao(t *testing.T, name, key string) (*keyedDao, error) {
+	args := ""
+	if name == "ByID" || name == "ByUser" {
+		args = "ids"
+	}
+	m := newTestCentral(&File{
+		Type:    "keyedDao",
+		Selects: []SQLContent{{Name: name, Args: args, Key: key, SQL: "select {{.fields}} from orders"}},
+	})
+	dao := &keyedDao{}
+	value := reflect.ValueOf(dao).Elem()
+	if err := m.convert(); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := value.Type().FieldByName(name)
+	sqlSet := m.fullNameMap["keyedDao"]
+	_, err := m.generateFunc(false, "keyedDao", sqlSet.Functions[name], f, daoDBs{}, sqlSet)
+	if err != nil {
+		return nil, err
+	}
+	return dao, nil
+}
+
+func TestKeyResolvedAtMap(t *testing.T) {
+	for _, c := range []struct {
+		name, key string
+		ok        bool
+	}{
+		{"ByID", "order_id", true},
+		{"ByUser", "user_id", true},
+		{"ByFieldName", "OrderID", true},
+		{"BadKey", "missing", false},
+		{"BadKeyType", "order_id", false},
+		{"ByID", "", false},
+	} {
+		_, err := mapKeyedDao(t, c.name, c.key)
+		if (err == nil) != c.ok {
+			t.Errorf("%s key=%q: expected ok=%v, got %v", c.name, c.key, c.ok, err)
+		}
+	}
+}
+
+func TestKeyOnlyOnSelect(t *testing.T) {
+	type insertDao struct {
+		DB     *sql.DB
+		Insert func(o *keyedOrder) error
+	}
+	m := newTestCentral(&File{
+		Type:    "insertDao",
+		Inserts: []SQLContent{{Name: "Insert", Args: "o", Key: "order_id", SQL: "insert into orders (user_id) values ({{arg .o.UserID}})"}},
+	})
+	if err := m.Map(&insertDao{DB: &sql.DB{}}); err == nil {
+		t.Error("expected key on insert to fail Map")
+	}
+
+	e := &SQLExecutor{Fn: Fn{Key: "order_id"}, ReturnTypes: []reflect.Type{reflect.TypeOf(int64(0))}}
+	if err := e.resolveKey(); err == nil {
+		t.Error("expected error for non-map result")
+	}
+}
+
+func TestToKeyedMap(t *testing.T) {
+	orders := []*keyedOrder{{1, 10}, {2, 10}, {3, 20}}
+
+	e := &SQLExecutor{Fn: Fn{Key: "user_id"}, ReturnTypes: []reflect.Type{reflect.TypeOf(map[int64][]*keyedOrder{})}}
+	e.DB = NewSQLExecutor("", "", e.ReturnTypes, &e.Fn, nil, nil, nil).DB
+	if err := e.resolveKey(); err != nil {
+		t.Fatal(err)
+	}
+	grouped := e.toKeyedMap(reflect.ValueOf(orders)).Interface().(map[int64][]*keyedOrder)
+	if len(grouped) != 2 || len(grouped[10]) != 2 || len(grouped[20]) != 1 || grouped[10][1].OrderID != 2 {
+		t.Errorf("grouped wrong: %v", grouped)
+	}
+
+	e.Fn.Key = "order_id"
+	e.ReturnTypes = []reflect.Type{reflect.TypeOf(map[int]*keyedOrder{})}
+	if err := e.resolveKey(); err != nil {
+		t.Fatal(err)
+	}
+	byID := e.toKeyedMap(reflect.ValueOf(orders)).Interface().(map[int]*keyedOrder)
+	if len(byID) != 3 || byID[3].UserID != 20 {
+		t.Errorf("keyed wrong: %v", byID)
+	}
+}
@@ -0,0 +1,253 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+const defaultIDColumn = "id"
+
+// <resultMap> 编译后的结构,描述一行中属于某个结构体的列
+type resultMap struct {
+	typ      reflect.Type // 结构体类型
+	prefix   string       // 列名前缀,包含上级的前缀
+	idColumn string       // 用于去重分组的完整列名
+	property []int        // 在上级结构体中的字段下标
+	many     bool         // collection
+	ptr      bool         // 字段或切片元素是指针
+	children []*resultMap
+}
+
+func compileResultMap(content *ResultMapContent, typ reflect.Type, prefix string) (*resultMap, error) {
+	r := &resultMap{typ: typ, prefix: prefix + content.Prefix}
+	idColumn := content.IDColumn
+	if idColumn == "" {
+		idColumn = defaultIDColumn
+	}
+	r.idColumn = r.prefix + idColumn
+	compileChild := func(child *ResultMapContent, many bool) error {
+		field, ok := typ.FieldByName(child.Property)
+		if !ok {
+			return fmt.Errorf("resultMap %s: %s has no field %s", content.ID, typ, child.Property)
+		}
+		fieldType := field.Type
+		if many {
+			if fieldType.Kind() != reflect.Slice {
+				return fmt.Errorf("resultMap %s: collection %s.%s must be a slice, but got %s", content.ID, typ, child.Property, fieldType)
+			}
+			fieldType = fieldType.Elem()
+		}
+		ptr := fieldType.Kind() == reflect.Ptr
+		if ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			return fmt.Errorf("resultMap %s: %s.%s must be struct, struct pointer or slice of them, but got %s", content.ID, typ, child.Property, field.Type)
+		}
+		c, err := compileResultMap(child, fieldType, r.prefix)
+		if err != nil {
+			return err
+		}
+		c.property, c.many, c.ptr = field.Index, many, ptr
+		r.children = append(r.children, c)
+		return nil
+	}
+	for i := range content.Collections {
+		if err := compileChild(&content.Collections[i], true); err != nil {
+			return nil, err
+		}
+	}
+	for i := range content.Associations {
+		if err := compileChild(&content.Associations[i], false); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// 已组装的对象,先以指针形式构建,全部行读取完后再写入上级字段
+type resultNode struct {
+	ptr      reflect.Value
+	children [][]*resultNode
+	seen     []map[interface{}]*resultNode
+}
+
+type resultColumn struct {
+	owner *resultMap
+	index []int
+}
+
+// 一次查询中列与 resultMap 的对应关系
+type resultPlan struct {
+	columns []resultColumn
+	types   []reflect.Type
+	idPos   map[*resultMap]int
+}
+
+// 列归属于前缀最长且存在对应字段的 resultMap
+func newResultPlan(root *resultMap, mapper *reflectx.Mapper, columns []string) *resultPlan {
+	p := &resultPlan{
+		columns: make([]resultColumn, len(columns)),
+		types:   make([]reflect.Type, len(columns)),
+		idPos:   map[*resultMap]int{},
+	}
+	var walk func(r *resultMap)
+	walk = func(r *resultMap) {
+		for i, column := range columns {
+			if column == r.idColumn {
+				p.idPos[r] = i
+			}
+			if !strings.HasPrefix(column, r.prefix) {
+				continue
+			}
+			if owner := p.columns[i].owner; owner != nil && len(owner.prefix) >= len(r.prefix) {
+				continue
+			}
+			index := mapper.TraversalsByName(r.typ, []string{column[len(r.prefix):]})[0]
+			if len(index) > 0 {
+				p.columns[i] = resultColumn{owner: r, index: index}
+				p.types[i] = r.typ.FieldByIndex(index).Type
+			}
+		}
+		for _, child := range r.children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return p
+}
+
+// 已映射的列扫描到 **FieldType,NULL 时为 nil
+func (p *resultPlan) dests() []interface{} {
+	dests := make([]interface{}, len(p.columns))
+	for i, typ := range p.types {
+		if typ == nil {
+			dests[i] = new(interface{})
+		} else {
+			dests[i] = reflect.New(reflect.PtrTo(typ)).Interface()
+		}
+	}
+	return dests
+}
+
+func (p *resultPlan) key(dests []interface{}, pos int) interface{} {
+	v := reflect.ValueOf(dests[pos]).Elem()
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	key := v.Interface()
+	if b, ok := key.([]byte); ok {
+		return string(b)
+	}
+	return key
+}
+
+func (p *resultPlan) fill(r *resultMap, st reflect.Value, dests []interface{}) {
+	for i, column := range p.columns {
+		if column.owner != r {
+			continue
+		}
+		if v := reflect.ValueOf(dests[i]).Elem(); !v.IsNil() {
+			reflectx.FieldByIndexes(st, column.index).Set(v.Elem())
+		}
+	}
+}
+
+func (p *resultPlan) visit(r *resultMap, dests []interface{}, seen map[interface{}]*resultNode, list *[]*resultNode) error {
+	pos, ok := p.idPos[r]
+	if !ok {
+		return fmt.Errorf("resultMap: id column %s of %s not found in result", r.idColumn, r.typ)
+	}
+	key := p.key(dests, pos)
+	if key == nil {
+		// left join 未匹配
+		return nil
+	}
+	node := seen[key]
+	if node == nil {
+		node = &resultNode{
+			ptr:      reflect.New(r.typ),
+			children: make([][]*resultNode, len(r.children)),
+			seen:     make([]map[interface{}]*resultNode, len(r.children)),
+		}
+		for i := range node.seen {
+			node.seen[i] = map[interface{}]*resultNode{}
+		}
+		p.fill(r, node.ptr.Elem(), dests)
+		seen[key] = node
+		*list = append(*list, node)
+	}
+	for i, child := range r.children {
+		if err := p.visit(child, dests, node.seen[i], &node.children[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resultMap) materialize(node *resultNode) reflect.Value {
+	st := node.ptr.Elem()
+	for i, child := range r.children {
+		field := st.FieldByIndex(child.property)
+		if child.many {
+			slice := reflect.MakeSlice(field.Type(), 0, len(node.children[i]))
+			for _, c := range node.children[i] {
+				slice = reflect.Append(slice, child.materialize(c))
+			}
+			field.Set(slice)
+		} else if len(node.children[i]) > 0 {
+			field.Set(child.materialize(node.children[i][0]))
+		}
+	}
+	if r.ptr {
+		return node.ptr
+	}
+	return st
+}
+
+func (e *SQLExecutor) selectResultMap(ctx context.Context, r runner, resultType reflect.Type, sqlString string, sqlArgs []interface{}) (reflect.Value, error) {
+	rows, err := r.QueryxContext(ctx, sqlString, sqlArgs...)
+	if err != nil {
+		return reflect.Zero(resultType), err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return reflect.Zero(resultType), err
+	}
+	plan := newResultPlan(e.resultMap, e.DB.Mapper, columns)
+	var roots []*resultNode
+	seen := map[interface{}]*resultNode{}
+	for rows.Next() {
+		dests := plan.dests()
+		if err := rows.Scan(dests...); err != nil {
+			return reflect.Zero(resultType), err
+		}
+		if err := plan.visit(e.resultMap, dests, seen, &roots); err != nil {
+			return reflect.Zero(resultType), err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return reflect.Zero(resultType), err
+	}
+
+	if resultType.Kind() == reflect.Slice {
+		list := reflect.MakeSlice(resultType, 0, len(roots))
+		for _, root := range roots {
+			list = reflect.Append(list, e.resultMap.materialize(root))
+		}
+		return list, nil
+	}
+	if len(roots) == 0 {
+		return reflect.Zero(resultType), sql.ErrNoRows
+	}
+	return e.resultMap.materialize(roots[0]), nil
+}
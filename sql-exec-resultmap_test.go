@@ -0,0 +1,112 @@
+package sago
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+type resultMapItem struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type resultMapOrder struct {
+	ID     int64           `db:"id"`
+	Amount float64         `db:"amount"`
+	Items  []resultMapItem `db:"-"`
+}
+
+type resultMapProfile struct {
+	ID  int64  `db:"id"`
+	Bio string `db:"bio"`
+}
+
+type resultMapUser struct {
+	ID      int64             `db:"id"`
+	Name    string            `db:"name"`
+	Orders  []*resultMapOrder `db:"-"`
+	Profile *resultMapProfile `db:"-"`
+}
+
+// 模拟 rows.Scan 写入 dests
+func scanResultRow(dests []interface{}, row []interface{}) {
+	for i, v := range row {
+		dv := reflect.ValueOf(dests[i]).Elem()
+		if v == nil {
+			continue
+		}
+		if dv.Kind() == reflect.Ptr {
+			p := reflect.New(dv.Type().Elem())
+			p.Elem().Set(reflect.ValueOf(v).Convert(dv.Type().Elem()))
+			dv.Set(p)
+		} else {
+			dv.Set(reflect.ValueOf(v))
+		}
+	}
+}
+
+func TestResultMap(t *testing.T) {
+	content := &ResultMapContent{
+		ID: "userWithOrders",
+		Collections: []ResultMapContent{{
+			Property:    "Orders",
+			Prefix:      "order_",
+			Collections: []ResultMapContent{{Property: "Items", Prefix: "item_"}},
+		}},
+		Associations: []ResultMapContent{{Property: "Profile", Prefix: "profile_"}},
+	}
+	r, err := compileResultMap(content, reflect.TypeOf(resultMapUser{}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"id", "name", "order_id", "order_amount", "order_item_id", "order_item_name", "profile_id", "profile_bio"}
+	rows := [][]interface{}{
+		{int64(1), "foo", int64(10), 1.5, int64(100), "apple", int64(5), "hi"},
+		{int64(1), "foo", int64(10), 1.5, int64(101), "pear", int64(5), "hi"},
+		{int64(1), "foo", int64(11), 2.5, nil, nil, int64(5), "hi"},
+		{int64(2), "bar", nil, nil, nil, nil, nil, nil},
+	}
+	plan := newResultPlan(r, reflectx.NewMapperFunc("db", sqlx.NameMapper), columns)
+	var roots []*resultNode
+	seen := map[interface{}]*resultNode{}
+	for _, row := range rows {
+		dests := plan.dests()
+		scanResultRow(dests, row)
+		if err := plan.visit(r, dests, seen, &roots); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(roots) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(roots))
+	}
+	foo := r.materialize(roots[0]).Interface().(resultMapUser)
+	bar := r.materialize(roots[1]).Interface().(resultMapUser)
+	if foo.Name != "foo" || len(foo.Orders) != 2 || foo.Orders[1].Amount != 2.5 {
+		t.Errorf("foo mapped wrong: %+v", foo)
+	}
+	if len(foo.Orders[0].Items) != 2 || foo.Orders[0].Items[1].Name != "pear" || len(foo.Orders[1].Items) != 0 {
+		t.Errorf("items mapped wrong: %+v", foo.Orders[0])
+	}
+	if foo.Profile == nil || foo.Profile.Bio != "hi" {
+		t.Errorf("profile mapped wrong: %+v", foo.Profile)
+	}
+	if bar.Name != "bar" || len(bar.Orders) != 0 || bar.Profile != nil {
+		t.Errorf("bar mapped wrong: %+v", bar)
+	}
+}
+
+func TestResultMapCompileErrors(t *testing.T) {
+	typ := reflect.TypeOf(resultMapUser{})
+	for _, content := range []*ResultMapContent{
+		{Collections: []ResultMapContent{{Property: "Missing"}}},
+		{Collections: []ResultMapContent{{Property: "Profile"}}},
+		{Associations: []ResultMapContent{{Property: "Name"}}},
+	} {
+		if _, err := compileResultMap(content, typ, ""); err == nil {
+			t.Errorf("expected error for %+v", content)
+		}
+	}
+}
@@ -1,20 +1,20 @@
 package sago
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
+
+	"github.com/jmoiron/sqlx"
 )
 
 var nilErr error
 
 func (e *SQLExecutor) SelectCache(args []reflect.Value) (results []reflect.Value) {
-	var keys []interface{}
-	for _, v := range args {
-		keys = append(keys, v.Interface())
-	}
 	dir := e.daoName + "." + e.Fn.Name
-	key := fmt.Sprint(keys)
+	_, keyArgs := e.splitArgs(args)
+	key := e.cacheKey(keyArgs)
 	fromCached, ok := e.Cache.Get(dir, key)
 	if ok {
 		return e.returnSelect(
@@ -23,45 +23,66 @@ func (e *SQLExecutor) SelectCache(args []reflect.Value) (results []reflect.Value
 		)
 	}
 	results = e.Select(args)
-	if results[1].IsNil() {
+	// (T, exist bool, error) 未查到时 error 也为 nil,不缓存,否则命中时会返回 exist=true
+	if results[len(results)-1].IsNil() && (len(results) == 2 || results[1].Bool()) {
 		e.Cache.Set(dir, key, clone(results[0]).Interface())
 	}
 	return results
 }
 
+// 返回值形式已在 Map 时检查,只有 (T, error) 和 (T, exist bool, error) 两种
+// 可变参数以 %#v 区分 ("a b") 与 ("a", "b")
+func (e *SQLExecutor) cacheKey(args []reflect.Value) string {
+	var keys []interface{}
+	for i, v := range args {
+		if e.variadic && i == len(args)-1 {
+			if v.Len() == 0 {
+				keys = append(keys, "[]")
+			} else {
+				keys = append(keys, fmt.Sprintf("%#v", v.Interface()))
+			}
+			continue
+		}
+		keys = append(keys, v.Interface())
+	}
+	return fmt.Sprint(keys)
+}
+
 func (e *SQLExecutor) returnSelect(object reflect.Value, err error) (results []reflect.Value) {
-	outNum := len(e.ReturnTypes)
-	switch outNum {
-	case 2:
+	if len(e.ReturnTypes) == 2 {
 		return []reflect.Value{
 			object,
 			reflect.ValueOf(&err).Elem(),
 		}
-	case 3:
-		if err == nil {
-			return []reflect.Value{
-				object,
-				reflect.ValueOf(true),
-				reflect.ValueOf(&err).Elem(),
-			}
-		} else if err == sql.ErrNoRows {
-			return []reflect.Value{
-				object,
-				reflect.ValueOf(false),
-				reflect.ValueOf(&nilErr).Elem(),
-			}
-		} else {
-			return []reflect.Value{
-				object,
-				reflect.ValueOf(false),
-				reflect.ValueOf(&err).Elem(),
-			}
+	}
+	if err == nil {
+		return []reflect.Value{
+			object,
+			reflect.ValueOf(true).Convert(e.ReturnTypes[1]),
+			reflect.ValueOf(&err).Elem(),
+		}
+	} else if err == sql.ErrNoRows {
+		return []reflect.Value{
+			object,
+			reflect.ValueOf(false).Convert(e.ReturnTypes[1]),
+			reflect.ValueOf(&nilErr).Elem(),
 		}
 	}
-	panic("select only support any,err or any,exist,err returned")
+	return []reflect.Value{
+		object,
+		reflect.ValueOf(false).Convert(e.ReturnTypes[1]),
+		reflect.ValueOf(&err).Elem(),
+	}
 }
 
 func (e *SQLExecutor) Select(args []reflect.Value) (results []reflect.Value) {
+	parent, args := e.splitArgs(args)
+	ctx, cancel := e.withTimeout(parent)
+	defer cancel()
+	if e.shards != nil {
+		value, err := e.selectShards(ctx, args)
+		return e.returnSelect(value, timeoutError(parent, ctx, err))
+	}
 	sqlString, sqlArgs, err := e.executeTpl(args)
 	if err != nil {
 		return e.returnSelect(
@@ -69,50 +90,58 @@ func (e *SQLExecutor) Select(args []reflect.Value) (results []reflect.Value) {
 			err,
 		)
 	}
+	db, done := e.reader(ctx)
+	defer done()
+	value, err := e.retryQuery(ctx, db, sqlString, sqlArgs)
+	return e.returnSelect(value, timeoutError(parent, ctx, err))
+}
+
+func (e *SQLExecutor) retryQuery(ctx context.Context, db *sqlx.DB, sqlString string, sqlArgs []interface{}) (value reflect.Value, err error) {
+	err = e.withRetry(ctx, db, false, func() error {
+		value, err = e.query(ctx, db, sqlString, sqlArgs)
+		return err
+	})
+	return value, err
+}
 
+func (e *SQLExecutor) query(ctx context.Context, db *sqlx.DB, sqlString string, sqlArgs []interface{}) (reflect.Value, error) {
 	resultType := e.ReturnTypes[0]
+	r, release, err := e.runner(ctx, db, sqlString)
+	if err != nil {
+		return reflect.Zero(resultType), err
+	}
+	defer release()
+	if e.resultMap != nil {
+		return e.selectResultMap(ctx, r, resultType, sqlString, sqlArgs)
+	}
+	if isDynamicResultType(resultType) {
+		return e.selectDynamic(ctx, r, resultType, sqlString, sqlArgs)
+	}
 	switch resultType.Kind() {
-	case reflect.Slice, reflect.Array:
+	case reflect.Map:
+		// 先查询为 []V 再按 key 组装
+		listType := resultType.Elem()
+		if listType.Kind() != reflect.Slice {
+			listType = reflect.SliceOf(listType)
+		}
+		listValue := reflect.New(listType)
+		err := r.SelectContext(ctx, listValue.Interface(), sqlString, sqlArgs...)
+		if err != nil {
+			return reflect.Zero(resultType), err
+		}
+		return e.toKeyedMap(listValue.Elem()), nil
+	case reflect.Slice:
 		listValue := reflect.New(resultType)
-		var err error
-		err = e.DB.Select(listValue.Interface(), sqlString, sqlArgs...)
-		return e.returnSelect(
-			listValue.Elem(),
-			err,
-		)
+		err := r.SelectContext(ctx, listValue.Interface(), sqlString, sqlArgs...)
+		return listValue.Elem(), err
 	case reflect.Ptr:
 		oneValue := reflect.New(resultType.Elem())
-		var err error
-		err = e.DB.Get(oneValue.Interface(), sqlString, sqlArgs...)
-		return e.returnSelect(
-			oneValue,
-			err,
-		)
-
-	case reflect.Struct,
-		reflect.Bool,
-		reflect.String,
-		reflect.Int,
-		reflect.Int8,
-		reflect.Int16,
-		reflect.Int32,
-		reflect.Int64,
-		reflect.Uint,
-		reflect.Uint8,
-		reflect.Uint16,
-		reflect.Uint32,
-		reflect.Uint64,
-		reflect.Float32,
-		reflect.Float64:
-		oneValue := reflect.New(resultType)
-		err := e.DB.Get(oneValue.Interface(), sqlString, sqlArgs...)
-		return e.returnSelect(
-			oneValue.Elem(),
-			err,
-		)
+		err := r.GetContext(ctx, oneValue.Interface(), sqlString, sqlArgs...)
+		return oneValue, err
 	default:
-		panic("not support such type " + resultType.String())
+		// 结构体及基本类型,已在 Map 时由 checkSelectReturns 检查
+		oneValue := reflect.New(resultType)
+		err := r.GetContext(ctx, oneValue.Interface(), sqlString, sqlArgs...)
+		return oneValue.Elem(), err
 	}
-
-	return nil
 }
@@ -3,30 +3,42 @@ package sago
 import "reflect"
 
 func (e *SQLExecutor) Execute(args []reflect.Value) (results []reflect.Value) {
-	sqlText, sqlArgs, err := e.executeTpl(args)
+	ctx, args := e.splitArgs(args)
+	db, sqlText, sqlArgs, err := e.renderWrite(args)
 	if err != nil {
 		return e.returnError(err)
 	}
-	rs, err := e.DB.Exec(sqlText, sqlArgs...)
+	rs, err := e.exec(ctx, db, sqlText, sqlArgs)
 	if err != nil {
 		return e.returnError(err)
 	}
-	var emptyError error
-	affected, _ := rs.RowsAffected()
-	if e.ReturnTypes[0].Kind() == reflect.Int64 {
-		return []reflect.Value{
-			reflect.ValueOf(affected),
-			reflect.ValueOf(&emptyError).Elem(),
-		}
+	return e.returnResult(rs)
+}
+
+// update/delete 与 execute 相同返回影响行数
+// 语句声明 mustAffect="true" 时,未影响任何行返回 ErrNotFound
+func (e *SQLExecutor) Update(args []reflect.Value) (results []reflect.Value) {
+	return e.modify(args)
+}
+
+func (e *SQLExecutor) Delete(args []reflect.Value) (results []reflect.Value) {
+	return e.modify(args)
+}
+
+func (e *SQLExecutor) modify(args []reflect.Value) (results []reflect.Value) {
+	ctx, args := e.splitArgs(args)
+	db, sqlText, sqlArgs, err := e.renderWrite(args)
+	if err != nil {
+		return e.returnError(err)
 	}
-	if e.ReturnTypes[0].Kind() == reflect.Int {
-		return []reflect.Value{
-			reflect.ValueOf(int(affected)),
-			reflect.ValueOf(&emptyError).Elem(),
-		}
+	rs, err := e.exec(ctx, db, sqlText, sqlArgs)
+	if err != nil {
+		return e.returnError(err)
 	}
-	if len(e.ReturnTypes) == 1 {
-		return e.returnError(emptyError)
+	if e.Fn.MustAffect {
+		if affected, _ := rs.RowsAffected(); affected == 0 {
+			return e.returnError(ErrNotFound)
+		}
 	}
-	panic("NOT SUPPORT")
+	return e.returnResult(rs)
 }
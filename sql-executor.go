@@ -2,12 +2,15 @@ package sago
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"github.com/jmoiron/sqlx"
 	"log"
 	"reflect"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 )
 
 var ShowSQL = false
@@ -16,6 +19,7 @@ type SQLExecutor struct {
 	Cache         Cache
 	daoName       string
 	Table         string
+	Vars          map[string]interface{}
 	FieldsString  string
 	Fn            Fn
 	Tpl           *template.Template
@@ -23,6 +27,26 @@ type SQLExecutor struct {
 	DB            *sqlx.DB
 	funcFactories []TemplateFuncFactory
 	ReturnTypes   []reflect.Type
+	execReturn    execReturn
+	keyIndex      []int
+	resultMap     *resultMap
+	hasTrim       bool
+	variadic      bool
+	hasCtx        bool
+	replicas      []*sql.DB
+	readDBs       []*sqlx.DB
+	balancer      Balancer
+	shards        []shardTarget
+	shardFunc     ShardFunc
+	shardKeyIndex int
+	retry         RetryPolicy
+	classifiers   map[Dialect]ErrorClassifier
+	timeout       time.Duration
+	stmts         *stmtRegistry
+	pinned        map[pinKey]*sqlx.Stmt
+	renderers     sync.Pool
+	// select 返回的结构体类型,{{.fields}}/{{fields}} 列出它的列
+	model reflect.Type
 }
 
 func NewSQLExecutor(table string, structTypeName string, returnTypes []reflect.Type, fn *Fn, tpl *template.Template, db *sql.DB, funcFactories []TemplateFuncFactory) *SQLExecutor {
@@ -34,26 +58,60 @@ func NewSQLExecutor(table string, structTypeName string, returnTypes []reflect.T
 		db:            db,
 		daoName:       structTypeName,
 		funcFactories: funcFactories,
+		hasTrim:       strings.Contains(fn.SQL, trimClose),
 	}
 	driverName := "mysql"
 	executor.DB = sqlx.NewDb(executor.db, driverName)
 	if typ := findStructType(returnTypes[0]); typ != nil {
-		names := executor.DB.Mapper.TypeMap(typ).Names
-		fields := []string{}
-		for v := range names {
-			fields = append(fields, v)
-		}
-		executor.FieldsString = "`" + strings.Join(fields, "`,`") + "`"
+		executor.model = typ
+		executor.FieldsString = joinColumns(columnsOf(typ), "", nil)
+	}
+	// 与渲染无关的函数只绑定一次,复制模板时一并带上
+	if tpl != nil {
+		executor.Tpl = tpl.Funcs(modelFuncs(executor.model))
 	}
 	return executor
 }
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+func (e *SQLExecutor) setReplicas(replicas []*sql.DB, balancer Balancer) {
+	e.replicas = replicas
+	e.balancer = balancer
+	e.readDBs = make([]*sqlx.DB, len(replicas))
+	for i, db := range replicas {
+		e.readDBs[i] = sqlx.NewDb(db, e.DB.DriverName())
+	}
+}
+
+// 函数的第一个参数为 context.Context 时将其分离
+func (e *SQLExecutor) splitArgs(args []reflect.Value) (context.Context, []reflect.Value) {
+	if !e.hasCtx {
+		return context.Background(), args
+	}
+	ctx, _ := args[0].Interface().(context.Context)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return ctx, args[1:]
+}
+
+// select 使用的数据库,有从库且 ctx 未要求主库时由 Balancer 选择
+func (e *SQLExecutor) reader(ctx context.Context) (*sqlx.DB, func()) {
+	if len(e.readDBs) == 0 || usePrimary(ctx) {
+		return e.DB, noop
+	}
+	i, done := e.balancer.Pick(e.replicas)
+	return e.readDBs[i], done
+}
+
 func findStructType(typ reflect.Type) reflect.Type {
 F:
 	switch typ.Kind() {
 	case reflect.Struct:
 		return typ
 
-	case reflect.Ptr, reflect.Slice:
+	case reflect.Ptr, reflect.Slice, reflect.Map:
 		typ = typ.Elem()
 		goto F
 	default:
@@ -61,33 +119,76 @@ F:
 	}
 }
 func (e *SQLExecutor) executeTpl(args []reflect.Value) (sql string, sqlArgs []interface{}, err error) {
-	ctx := map[string]interface{}{}
-	for i, v := range args {
-		ctx[e.Fn.Args[i]] = v.Interface()
-	}
-	tpl, _ := e.Tpl.Clone()
-	ctx["table"] = e.Table
-	ctx["fields"] = e.FieldsString
-	buf := bytes.NewBuffer(nil)
-
-	fnCtx := &FnCtx{Args: []interface{}{}}
+	return e.renderTpl(args, e.Table)
+}
 
-	fnMap := template.FuncMap{}
+// 渲染语句所需的对象:绑定了模板函数的模板、收集参数的 FnCtx、模板数据与缓冲区
+// 函数只在创建时绑定一次,用完放回 SQLExecutor 的 sync.Pool
+type renderer struct {
+	tpl   *template.Template
+	fnCtx *FnCtx
+	data  map[string]interface{}
+	buf   bytes.Buffer
+}
 
+func (e *SQLExecutor) newRenderer() *renderer {
+	r := &renderer{
+		fnCtx: &FnCtx{},
+		data:  make(map[string]interface{}, len(e.Fn.Args)+3),
+	}
+	fnMap := make(template.FuncMap, len(e.funcFactories))
 	for _, factory := range e.funcFactories {
-		fnMap[factory.Name] = factory.Create(fnCtx)
+		fnMap[factory.Name] = factory.Create(r.fnCtx)
 	}
+	r.tpl = template.Must(e.Tpl.Clone()).Funcs(fnMap)
+	return r
+}
 
-	tpl.Funcs(fnMap)
+func (e *SQLExecutor) getRenderer() *renderer {
+	if r, ok := e.renderers.Get().(*renderer); ok {
+		return r
+	}
+	return e.newRenderer()
+}
 
-	err = tpl.Execute(buf, ctx)
+// 放回前清除参数,避免池中的对象持有调用者的值
+func (e *SQLExecutor) putRenderer(r *renderer) {
+	for _, name := range e.Fn.Args {
+		r.data[name] = nil
+	}
+	for i := range r.fnCtx.Args {
+		r.fnCtx.Args[i] = nil
+	}
+	r.fnCtx.Args = r.fnCtx.Args[:0]
+	r.buf.Reset()
+	e.renderers.Put(r)
+}
 
+// 以 table 作为 {{.table}} 渲染,分片时为分片的物理表
+func (e *SQLExecutor) renderTpl(args []reflect.Value, table string) (sql string, sqlArgs []interface{}, err error) {
+	r := e.getRenderer()
+	defer e.putRenderer(r)
+	for i, v := range args {
+		r.data[e.Fn.Args[i]] = v.Interface()
+	}
+	r.data["table"] = table
+	r.data["fields"] = e.FieldsString
+	r.data["vars"] = e.Vars
+
+	err = r.tpl.Execute(&r.buf, r.data)
 	if err != nil {
 		return "", nil, err
 	}
-	sql = buf.String()
+	sql = r.buf.String()
+	if e.hasTrim {
+		sql, err = applyTrims(sql)
+		if err != nil {
+			return "", nil, err
+		}
+	}
 
-	sqlArgs = fnCtx.Args
+	sqlArgs = make([]interface{}, len(r.fnCtx.Args))
+	copy(sqlArgs, r.fnCtx.Args)
 	if ShowSQL {
 		log.Println(sql, sqlArgs)
 	}
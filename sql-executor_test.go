@@ -0,0 +1,99 @@
+package sago
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRenderConcurrent(t *testing.T) {
+	m := New()
+	fn := &Fn{Name: "Find", SQL: "select * from {{.table}} where `name` = {{arg .name}} and `id` {{in .ids}}", Args: []string{"name", "ids"}}
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSQLExecutor("user", "dao", []reflect.Type{reflect.TypeOf(0), emptyErrorType}, fn, tpl, nil, m.funcFactories)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				name := fmt.Sprint(g, "-", i)
+				ids := make([]int, i%3+1)
+				sqlText, sqlArgs, err := e.executeTpl([]reflect.Value{reflect.ValueOf(name), reflect.ValueOf(ids)})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(sqlArgs) != len(ids)+1 || sqlArgs[0] != name {
+					t.Errorf("%s: unexpected args %v", sqlText, sqlArgs)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// 放回池中的对象不再持有参数
+	r := e.getRenderer()
+	if r.data["name"] != nil || len(r.fnCtx.Args) != 0 {
+		t.Errorf("renderer not reset: %v %v", r.data, r.fnCtx.Args)
+	}
+}
+
+func TestRenderFuncs(t *testing.T) {
+	m := New()
+	m.AddFunc("upper", func(ctx *FnCtx) TemplateFunc {
+		return func(v interface{}) (string, error) {
+			ctx.Args = append(ctx.Args, strings.ToUpper(fmt.Sprint(v)))
+			return "?", nil
+		}
+	})
+	u := struct{ Name string }{"bar"}
+	for _, c := range []struct {
+		sql, args, expected string
+		values              []interface{}
+		expectedArgs        []interface{}
+	}{
+		{
+			sql:          "select 1 where name = {{.name | upper}}{{if .ids}} and id in ({{range $i, $id := .ids}}{{if $i}},{{end}}{{arg $id}}{{end}}){{end}}",
+			args:         "name, ids",
+			values:       []interface{}{"foo", []int{1, 2}},
+			expected:     "select 1 where name = ? and id in (?,?)",
+			expectedArgs: []interface{}{"FOO", 1, 2},
+		},
+		{
+			// 以子数据调用 define 的模板,其中的函数仍写入本次渲染的参数
+			sql:          `{{define "byName"}}name = {{arg .Name}} and alias = {{upper .Name}}{{end}}select 1 where {{template "byName" .u}}`,
+			args:         "u",
+			values:       []interface{}{u},
+			expected:     "select 1 where name = ? and alias = ?",
+			expectedArgs: []interface{}{"bar", "BAR"},
+		},
+	} {
+		fn := &Fn{Name: "Find", Args: strings.Split(strings.Replace(c.args, " ", "", -1), ","), SQL: c.sql}
+		tpl, err := m.parseTemplate(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewSQLExecutor("user", "dao", []reflect.Type{reflect.TypeOf(0), emptyErrorType}, fn, tpl, nil, m.funcFactories)
+		var values []reflect.Value
+		for _, v := range c.values {
+			values = append(values, reflect.ValueOf(v))
+		}
+		for i := 0; i < 3; i++ {
+			sqlText, sqlArgs, err := e.executeTpl(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sqlText != c.expected || !reflect.DeepEqual(sqlArgs, c.expectedArgs) {
+				t.Errorf("got %s %v", sqlText, sqlArgs)
+			}
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package sago
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 执行 SQL 的对象,*sqlx.DB 直接执行 SQL 文本,preparedRunner 使用预编译的语句
+type runner interface {
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type preparedRunner struct {
+	stmt *sqlx.Stmt
+}
+
+func (r preparedRunner) SelectContext(ctx context.Context, dest interface{}, _ string, args ...interface{}) error {
+	return r.stmt.SelectContext(ctx, dest, args...)
+}
+
+func (r preparedRunner) GetContext(ctx context.Context, dest interface{}, _ string, args ...interface{}) error {
+	return r.stmt.GetContext(ctx, dest, args...)
+}
+
+func (r preparedRunner) QueryxContext(ctx context.Context, _ string, args ...interface{}) (*sqlx.Rows, error) {
+	return r.stmt.QueryxContext(ctx, args...)
+}
+
+func (r preparedRunner) ExecContext(ctx context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	return r.stmt.ExecContext(ctx, args...)
+}
+
+// 每个 DB 一个按 SQL 文本索引的 LRU,超出容量时淘汰最久未使用的语句
+// 语句以引用计数借出,被淘汰时仍在使用的语句由最后一次 release 关闭
+type stmtCache struct {
+	mu    sync.Mutex
+	db    *sqlx.DB
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type stmtEntry struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(db *sqlx.DB, size int) *stmtCache {
+	return &stmtCache{db: db, size: size, items: map[string]*list.Element{}, order: list.New()}
+}
+
+// 借出 query 的预编译语句,用完后必须调用 release
+func (c *stmtCache) get(ctx context.Context, query string) (*stmtEntry, error) {
+	c.mu.Lock()
+	if item, ok := c.items[query]; ok {
+		c.order.MoveToFront(item)
+		entry := item.Value.(*stmtEntry)
+		entry.refs++
+		c.mu.Unlock()
+		return entry, nil
+	}
+	c.mu.Unlock()
+
+	stmt, err := c.db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if item, ok := c.items[query]; ok {
+		// 并发时其他调用已经缓存了同样的语句
+		c.order.MoveToFront(item)
+		entry := item.Value.(*stmtEntry)
+		entry.refs++
+		c.mu.Unlock()
+		stmt.Close()
+		return entry, nil
+	}
+	entry := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	c.items[query] = c.order.PushFront(entry)
+	var closing []*sqlx.Stmt
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		old := oldest.Value.(*stmtEntry)
+		delete(c.items, old.query)
+		old.evicted = true
+		if old.refs == 0 {
+			closing = append(closing, old.stmt)
+		}
+	}
+	c.mu.Unlock()
+	for _, s := range closing {
+		s.Close()
+	}
+	return entry, nil
+}
+
+// 归还 get 借出的语句,已被淘汰且无人使用时关闭
+func (c *stmtCache) release(entry *stmtEntry) {
+	c.mu.Lock()
+	entry.refs--
+	closing := entry.evicted && entry.refs == 0
+	c.mu.Unlock()
+	if closing {
+		entry.stmt.Close()
+	}
+}
+
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	var closing []*sqlx.Stmt
+	for item := c.order.Front(); item != nil; item = item.Next() {
+		entry := item.Value.(*stmtEntry)
+		entry.evicted = true
+		if entry.refs == 0 {
+			closing = append(closing, entry.stmt)
+		}
+	}
+	c.items, c.order = map[string]*list.Element{}, list.New()
+	c.mu.Unlock()
+	for _, s := range closing {
+		s.Close()
+	}
+}
+
+// Central 的所有预编译语句,Central.Close 时关闭
+type stmtRegistry struct {
+	mu     sync.Mutex
+	size   int
+	caches map[*sql.DB]*stmtCache
+	// 重复 Map 同一语句时复用已预编译的语句
+	pinned map[pinKey]*sqlx.Stmt
+}
+
+func newStmtRegistry(size int) *stmtRegistry {
+	return &stmtRegistry{size: size, caches: map[*sql.DB]*stmtCache{}, pinned: map[pinKey]*sqlx.Stmt{}}
+}
+
+func (r *stmtRegistry) cache(db *sqlx.DB) *stmtCache {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.caches[db.DB]
+	if !ok {
+		c = newStmtCache(db, r.size)
+		r.caches[db.DB] = c
+	}
+	return c
+}
+
+func (r *stmtRegistry) pin(ctx context.Context, db *sqlx.DB, query string) (*sqlx.Stmt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := pinKey{db.DB, query}
+	if stmt, ok := r.pinned[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	r.pinned[key] = stmt
+	return stmt, nil
+}
+
+func (r *stmtRegistry) close() {
+	r.mu.Lock()
+	caches, pinned := r.caches, r.pinned
+	r.caches, r.pinned = map[*sql.DB]*stmtCache{}, map[pinKey]*sqlx.Stmt{}
+	r.mu.Unlock()
+	for _, c := range caches {
+		c.close()
+	}
+	for _, stmt := range pinned {
+		stmt.Close()
+	}
+}
+
+// 分片可能共用一个 DB,以 DB 和 SQL 文本区分 Map 时预编译的语句
+type pinKey struct {
+	db    *sql.DB
+	query string
+}
+
+// 执行 sqlText 使用的 runner,开启预编译缓存时使用预编译的语句
+// 执行完后调用 release 归还从 LRU 借出的语句
+func (e *SQLExecutor) runner(ctx context.Context, db *sqlx.DB, sqlText string) (r runner, release func(), err error) {
+	if e.stmts == nil {
+		return db, noop, nil
+	}
+	if stmt := e.pinned[pinKey{db.DB, sqlText}]; stmt != nil {
+		return preparedRunner{stmt}, noop, nil
+	}
+	cache := e.stmts.cache(db)
+	entry, err := cache.get(ctx, sqlText)
+	if err != nil {
+		return nil, noop, err
+	}
+	return preparedRunner{entry.stmt}, func() { cache.release(entry) }, nil
+}
+
+// 模板输出的 SQL 是否与参数无关
+// 只包含文本、{{.table}}、{{.fields}}、{{.vars.x}}、{{arg .x}} 和参数为常量的 {{fields}} 时,每次渲染的 SQL 都相同
+func isStaticTemplate(tpl *template.Template) bool {
+	if tpl == nil || tpl.Tree == nil {
+		return false
+	}
+	for _, node := range tpl.Tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) != 1 {
+				return false
+			}
+			switch arg := n.Pipe.Cmds[0].Args[0].(type) {
+			case *parse.FieldNode:
+				if len(n.Pipe.Cmds[0].Args) != 1 || (arg.Ident[0] != "table" && arg.Ident[0] != "fields" && arg.Ident[0] != "vars") {
+					return false
+				}
+			case *parse.IdentifierNode:
+				if arg.Ident == MethodFields || arg.Ident == MethodFieldsExcept {
+					for _, a := range n.Pipe.Cmds[0].Args[1:] {
+						if _, ok := a.(*parse.StringNode); !ok {
+							return false
+						}
+					}
+				} else if arg.Ident != MethodNameArg {
+					return false
+				}
+			default:
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Map 时渲染用的参数,指针指向零值,使 {{arg .u.Name}} 可以渲染
+func zeroArgs(argTypes []reflect.Type) []reflect.Value {
+	args := make([]reflect.Value, len(argTypes))
+	for i, typ := range argTypes {
+		if typ.Kind() == reflect.Ptr {
+			args[i] = reflect.New(typ.Elem())
+		} else {
+			args[i] = reflect.Zero(typ)
+		}
+	}
+	return args
+}
+
+// 静态语句在 Map 时以参数的零值渲染一次,在会用到的每个 DB 上预编译
+// 预编译失败时不报错,调用时再通过 LRU 预编译
+func (e *SQLExecutor) prepareStatic(ctx context.Context, argTypes []reflect.Type) {
+	if !isStaticTemplate(e.Tpl) {
+		return
+	}
+	args := zeroArgs(argTypes)
+	targets := []shardTarget{{e.DB, e.Table}}
+	if e.shards != nil {
+		targets = e.shards
+	} else if e.Fn.Type == "select" {
+		for _, db := range e.readDBs {
+			targets = append(targets, shardTarget{db, e.Table})
+		}
+	}
+	e.pinned = map[pinKey]*sqlx.Stmt{}
+	for _, target := range targets {
+		// DAO 未设置 DB 时没有可以预编译的连接
+		if target.db == nil || target.db.DB == nil {
+			continue
+		}
+		sqlText, _, err := e.renderTpl(args, target.table)
+		if err != nil {
+			return
+		}
+		stmt, err := e.stmts.pin(ctx, target.db, sqlText)
+		if err != nil {
+			continue
+		}
+		e.pinned[pinKey{target.db.DB, sqlText}] = stmt
+	}
+}
@@ -0,0 +1,264 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestIsStaticTemplate(t *testing.T) {
+	m := New()
+	cases := []struct {
+		sql    string
+		static bool
+	}{
+		{"select 1", true},
+		{"select {{.fields}} from {{.vars.schema}}.{{.table}} where id = {{arg .id}} and name = {{arg .u.Name}}", true},
+		{"select * from t where id {{in .ids}}", false},
+		{"select * from t {{if .name}}where name = {{arg .name}}{{end}}", false},
+		{"select * from t {{orderBy .sort \"id\"}}", false},
+		{"select * from t where name = '{{.name}}'", false},
+		{"select * from t where id = {{arg .id | printf \"%v\"}}", false},
+	}
+	for _, c := range cases {
+		tpl, err := m.parseTemplate(&Fn{Name: "F", SQL: c.sql})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isStaticTemplate(tpl); got != c.static {
+			t.Errorf("%s: static = %v", c.sql, got)
+		}
+	}
+}
+
+func TestStmtCacheClose(t *testing.T) {
+	registry := newStmtRegistry(2)
+	registry.close()
+	if len(registry.caches) != 0 || len(registry.pinned) != 0 {
+		t.Error("registry not reset")
+	}
+	if err := New().Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// 只支持预编译的驱动,记录关闭的语句
+type prepareDriver struct {
+	mu     sync.Mutex
+	closed map[string]int
+}
+
+// 共用的驱动在每个测试开始时清空计数,-count 多次运行时不累加
+func (d *prepareDriver) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = map[string]int{}
+}
+
+func (d *prepareDriver) closedCount(query string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed[query]
+}
+
+type prepareConn struct{ d *prepareDriver }
+
+type prepareStmt struct {
+	d     *prepareDriver
+	query string
+}
+
+func (d *prepareDriver) Open(string) (driver.Conn, error) { return prepareConn{d}, nil }
+
+func (c prepareConn) Prepare(query string) (driver.Stmt, error) {
+	return &prepareStmt{c.d, query}, nil
+}
+func (c prepareConn) Close() error              { return nil }
+func (c prepareConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *prepareStmt) Close() error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.closed[s.query]++
+	return nil
+}
+func (s *prepareStmt) NumInput() int { return -1 }
+func (s *prepareStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s *prepareStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var (
+	testPrepareDriver   = &prepareDriver{closed: map[string]int{}}
+	registerPrepareOnce sync.Once
+)
+
+func openPrepareDB(t *testing.T) *sqlx.DB {
+	registerPrepareOnce.Do(func() {
+		sql.Register("sago-prepare-test", testPrepareDriver)
+	})
+	db, err := sqlx.Open("sago-prepare-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStmtCacheLRU(t *testing.T) {
+	d := testPrepareDriver
+	d.reset()
+	db := openPrepareDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	registry := newStmtRegistry(2)
+	cache := registry.cache(db)
+	if registry.cache(db) != cache {
+		t.Fatal("expected one cache per DB")
+	}
+	a, _ := cache.get(ctx, "a")
+	cache.release(a)
+	b, _ := cache.get(ctx, "b")
+	cache.release(b)
+	again, _ := cache.get(ctx, "a")
+	if again != a {
+		t.Error("expected cached statement")
+	}
+	cache.release(again)
+	c, _ := cache.get(ctx, "c")
+	cache.release(c)
+	if cache.len() != 2 || d.closedCount("b") != 1 || d.closedCount("a") != 0 {
+		t.Errorf("expected b evicted: len %d closed %v", cache.len(), d.closed)
+	}
+	registry.close()
+	if d.closedCount("a") != 1 || d.closedCount("c") != 1 {
+		t.Errorf("expected all closed: %v", d.closed)
+	}
+}
+
+func TestStmtCacheEvictInUse(t *testing.T) {
+	d := testPrepareDriver
+	d.reset()
+	db := openPrepareDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	cache := newStmtCache(db, 1)
+	inUse, _ := cache.get(ctx, "in-use")
+	other, _ := cache.get(ctx, "in-use-other")
+	cache.release(other)
+	if d.closedCount("in-use") != 0 {
+		t.Fatal("statement closed while in use")
+	}
+	if _, err := inUse.stmt.ExecContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cache.release(inUse)
+	if d.closedCount("in-use") != 1 {
+		t.Errorf("expected evicted statement closed on release, closed %d", d.closedCount("in-use"))
+	}
+}
+
+// 容量为 1 时交替执行两条语句,每次都会淘汰另一条正在使用的语句
+func TestStmtCacheConcurrentEviction(t *testing.T) {
+	db := openPrepareDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	registry := newStmtRegistry(1)
+	defer registry.close()
+	e := &SQLExecutor{stmts: registry}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				query := []string{"alternate-a", "alternate-b"}[(g+i)%2]
+				r, release, err := e.runner(ctx, db, query)
+				if err == nil {
+					// 让出执行,使另一条语句的淘汰发生在借出与执行之间
+					runtime.Gosched()
+					_, err = r.ExecContext(ctx, query)
+					release()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestPrepareAfterValidation(t *testing.T) {
+	type preparedDao struct {
+		DB    *sql.DB
+		Find  func(id int64) (int64, error)
+		ByKey func() (map[int64]keyedOrder, error)
+	}
+	db := openPrepareDB(t)
+	defer db.Close()
+
+	m := newTestCentral(&File{Type: "preparedDao", Table: "orders", Selects: []SQLContent{
+		{Name: "Find", Args: "id", SQL: "select id from {{.table}} where id = {{arg .id}}"},
+		{Name: "ByKey", Key: "missing", SQL: "select {{.fields}} from {{.table}}"},
+	}})
+	m.PrepareCache = 4
+	if err := m.Map(&preparedDao{DB: db.DB}); err == nil {
+		t.Fatal("expected error for bad key")
+	}
+	// 只有通过检查的 Find 被预编译
+	if len(m.stmts.pinned) != 1 {
+		t.Errorf("expected only Find prepared, got %d", len(m.stmts.pinned))
+	}
+	m.Close()
+
+	m.fullNameMap["preparedDao"].Functions["ByKey"].Key = "order_id"
+	dao := &preparedDao{DB: db.DB}
+	if err := m.Map(dao); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.stmts.pinned) != 2 {
+		t.Errorf("expected both static statements prepared, got %d", len(m.stmts.pinned))
+	}
+	// 再次 Map 复用已预编译的语句
+	if err := m.Map(&preparedDao{DB: db.DB}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.stmts.pinned) != 2 || len(m.statements) != 2 {
+		t.Errorf("expected 2 statements after Map again, got %d pinned %d mapped", len(m.stmts.pinned), len(m.statements))
+	}
+}
+
+func TestPrepareWithoutDB(t *testing.T) {
+	type preparedDao struct {
+		DB   *sql.DB
+		Find func(id int64) (int64, error)
+	}
+	m := newTestCentral(&File{Type: "preparedDao", Table: "orders", Selects: []SQLContent{
+		{Name: "Find", Args: "id", SQL: "select id from {{.table}} where id = {{arg .id}}"},
+	}})
+	m.PrepareCache = 4
+	defer m.Close()
+	if err := m.Map(&preparedDao{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.stmts.pinned) != 0 {
+		t.Errorf("expected nothing prepared without DB, got %d", len(m.stmts.pinned))
+	}
+}
@@ -0,0 +1,25 @@
+package sago
+
+import (
+	"context"
+	"errors"
+)
+
+// 语句超过 timeout 属性或 Central.Timeout 设置的时间
+var ErrTimeout = errors.New("sago: statement timeout")
+
+// 在调用者的 ctx 上加上语句的超时,调用者的截止时间更早时以调用者的为准
+func (e *SQLExecutor) withTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if e.timeout <= 0 {
+		return parent, noop
+	}
+	return context.WithTimeout(parent, e.timeout)
+}
+
+// 由语句的超时而不是调用者的 ctx 结束时返回 ErrTimeout
+func timeoutError(parent, ctx context.Context, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return ErrTimeout
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package sago
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeoutError(t *testing.T) {
+	e := &SQLExecutor{timeout: time.Millisecond}
+	parent := context.Background()
+	ctx, cancel := e.withTimeout(parent)
+	defer cancel()
+	<-ctx.Done()
+	if err := timeoutError(parent, ctx, ctx.Err()); err != ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if err := timeoutError(parent, ctx, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	// 调用者的 ctx 先结束时保留原来的错误
+	callerCtx, callerCancel := context.WithTimeout(parent, time.Millisecond)
+	defer callerCancel()
+	e.timeout = time.Hour
+	ctx, cancel = e.withTimeout(callerCtx)
+	defer cancel()
+	<-ctx.Done()
+	if err := timeoutError(callerCtx, ctx, ctx.Err()); err != context.DeadlineExceeded {
+		t.Errorf("expected caller's error, got %v", err)
+	}
+
+	e.timeout = 0
+	if ctx, _ := e.withTimeout(parent); ctx != parent {
+		t.Error("zero timeout should keep the caller's ctx")
+	}
+	other := errors.New("other")
+	if err := timeoutError(parent, parent, other); err != other {
+		t.Error(err)
+	}
+}
+
+func TestTimeoutAttr(t *testing.T) {
+	type timeoutDao struct {
+		DB   *sql.DB
+		Find func(ctx context.Context) (int64, error)
+	}
+	find := SQLContent{Name: "Find", Timeout: "300ms", SQL: "select 1"}
+	m := newTestCentral(&File{Type: "timeoutDao", Selects: []SQLContent{find}})
+	m.Timeout = time.Second
+	if err := m.Map(&timeoutDao{DB: &sql.DB{}}); err != nil {
+		t.Fatal(err)
+	}
+	if fn := m.fullNameMap["timeoutDao"].Functions["Find"]; fn.Timeout != 300*time.Millisecond {
+		t.Errorf("timeout = %v", fn.Timeout)
+	}
+
+	find.Timeout = "later"
+	if err := newTestCentral(&File{Type: "timeoutDao", Selects: []SQLContent{find}}).Map(&timeoutDao{DB: &sql.DB{}}); err == nil {
+		t.Error("expected error for bad timeout")
+	}
+}
@@ -2,17 +2,30 @@ package sago
 
 import (
 	"encoding/xml"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"reflect"
 	"strings"
+	"text/template"
 )
 
 const (
 	MethodNameArg = "arg"
 	MethodInArg   = "in"
+	MethodIdent   = "ident"
+	MethodOrderBy = "orderBy"
+	MethodDir     = "dir"
 )
 
+// 不依赖参数收集的内置模板函数,用于安全地拼接标识符
+var builtinFuncs = template.FuncMap{
+	MethodIdent:   identFunc,
+	MethodOrderBy: orderByFunc,
+	MethodDir:     dirFunc,
+	MethodColumns: columnsFunc,
+}
+
 var emptyReflectValue = reflect.Value{}
 
 func empty(v interface{}) (string, error) {
@@ -32,6 +45,9 @@ func argFunc(ctx *FnCtx) TemplateFunc {
 func inFunc(ctx *FnCtx) TemplateFunc {
 	return func(args interface{}) (string, error) {
 		v := reflect.ValueOf(args)
+		if !v.IsValid() || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+			return "", fmt.Errorf("in: expected a non-empty slice, but got %v", args)
+		}
 		length := v.Len()
 		for i := 0; i < length; i++ {
 			ctx.Args = append(ctx.Args, v.Index(i).Interface())
@@ -40,6 +56,71 @@ func inFunc(ctx *FnCtx) TemplateFunc {
 	}
 }
 
+// {{ident .col "name,created_at"}} 值必须在白名单中,输出 `name`
+func identFunc(value interface{}, allowed string) (string, error) {
+	name := fmt.Sprint(value)
+	if !inAllowList(name, allowed) {
+		return "", fmt.Errorf("ident: %q is not allowed", name)
+	}
+	return quoteIdent(name), nil
+}
+
+// {{orderBy .sort "name,id"}} 将 -name,id 解析为 ORDER BY `name` DESC, `id` ASC
+// 为空时输出空字符串
+func orderByFunc(value interface{}, allowed string) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	var items []string
+	for _, item := range strings.Split(fmt.Sprint(value), ",") {
+		item = strings.TrimSpace(item)
+		direction := " ASC"
+		switch {
+		case item == "":
+			continue
+		case item[0] == '-':
+			direction = " DESC"
+			item = item[1:]
+		case item[0] == '+':
+			item = item[1:]
+		}
+		if !inAllowList(item, allowed) {
+			return "", fmt.Errorf("orderBy: %q is not allowed", item)
+		}
+		items = append(items, quoteIdent(item)+direction)
+	}
+	if len(items) == 0 {
+		return "", nil
+	}
+	return "ORDER BY " + strings.Join(items, ", "), nil
+}
+
+// {{dir .d}} 只接受 asc/desc
+func dirFunc(value interface{}) (string, error) {
+	direction := strings.ToUpper(fmt.Sprint(value))
+	if direction != "ASC" && direction != "DESC" {
+		return "", fmt.Errorf("dir: %q is neither asc nor desc", value)
+	}
+	return direction, nil
+}
+
+func inAllowList(name, allowed string) bool {
+	for _, v := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(v) == name && name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.Replace(part, "`", "``", -1) + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
 func parseXML(path string) (f *File, err error) {
 	xmlData, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -49,6 +130,8 @@ func parseXML(path string) (f *File, err error) {
 		Selects:  []SQLContent{},
 		Executes: []SQLContent{},
 		Inserts:  []SQLContent{},
+		Updates:  []SQLContent{},
+		Deletes:  []SQLContent{},
 	}
 	err = xml.Unmarshal(xmlData, f)
 	return
@@ -63,6 +146,8 @@ func parseYAML(path string) (f *File, err error) {
 		Selects:  []SQLContent{},
 		Executes: []SQLContent{},
 		Inserts:  []SQLContent{},
+		Updates:  []SQLContent{},
+		Deletes:  []SQLContent{},
 	}
 	err = yaml.Unmarshal(data, f)
 	return
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"text/template"
 	"bytes"
+	"reflect"
 )
 
 func TestInStrs(t *testing.T) {
@@ -95,3 +96,68 @@ func TestInInterfaces(t *testing.T) {
 	}
 	t.Log(buf.String(),ctx.Args)
 }
+
+func TestIdent(t *testing.T) {
+	if s, err := identFunc("created_at", "name, created_at"); err != nil || s != "`created_at`" {
+		t.Error(s, err)
+	}
+	if s, err := identFunc("u.name", "u.name"); err != nil || s != "`u`.`name`" {
+		t.Error(s, err)
+	}
+	for _, v := range []interface{}{"password", "name`; drop table user; --", "", nil} {
+		if _, err := identFunc(v, "name,created_at"); err == nil {
+			t.Errorf("%v should not be allowed", v)
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	for sort, expected := range map[string]string{
+		"-name,id": "ORDER BY `name` DESC, `id` ASC",
+		"+id":      "ORDER BY `id` ASC",
+		" name , ": "ORDER BY `name` ASC",
+		"":         "",
+	} {
+		if s, err := orderByFunc(sort, "name,id"); err != nil || s != expected {
+			t.Errorf("%q: got %q %v, expected %q", sort, s, err, expected)
+		}
+	}
+	if s, err := orderByFunc(nil, "name"); err != nil || s != "" {
+		t.Error(s, err)
+	}
+	for _, sort := range []string{"password", "-", "name desc", "id;drop table user"} {
+		if _, err := orderByFunc(sort, "name,id"); err == nil {
+			t.Errorf("%q should not be allowed", sort)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	if s, err := dirFunc("desc"); err != nil || s != "DESC" {
+		t.Error(s, err)
+	}
+	if s, err := dirFunc("ASC"); err != nil || s != "ASC" {
+		t.Error(s, err)
+	}
+	for _, d := range []interface{}{"", "up", "asc;", nil} {
+		if _, err := dirFunc(d); err == nil {
+			t.Errorf("%v should not be allowed", d)
+		}
+	}
+}
+
+func TestInvalidIdentFailsRender(t *testing.T) {
+	m := New()
+	fn := &Fn{Name: "Sorted", Args: []string{"sort"}, SQL: `select * from {{.table}} {{orderBy .sort "name,id"}}`}
+	tpl, err := m.parseTemplate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSQLExecutor("user", "UserDao", []reflect.Type{emptyErrorType}, fn, tpl, nil, m.funcFactories)
+	if sql, _, err := e.executeTpl([]reflect.Value{reflect.ValueOf("-id")}); err != nil || sql != "select * from user ORDER BY `id` DESC" {
+		t.Error(sql, err)
+	}
+	if _, _, err := e.executeTpl([]reflect.Value{reflect.ValueOf("password")}); err == nil {
+		t.Error("expected executeTpl to fail")
+	}
+}